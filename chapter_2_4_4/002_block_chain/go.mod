@@ -0,0 +1,14 @@
+module test/blockchain-project/002_block_chain
+
+go 1.23.0
+
+require test/blockchain-project/004_db_store v0.0.0
+
+require (
+	github.com/klauspost/compress v1.17.11 // indirect
+	go.etcd.io/bbolt v1.4.3 // indirect
+	golang.org/x/crypto v0.36.0 // indirect
+	golang.org/x/sys v0.31.0 // indirect
+)
+
+replace test/blockchain-project/004_db_store => ../004_db_store
@@ -0,0 +1,97 @@
+package block
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/**
+区块的数据结构
+Block 由区块头和交易信息两部分组成
+首先从 “区块” 谈起。在区块链中，真正存储有效信息的是区块（block）。而在比特币中，真正有价值的信息就是交易（transaction）。实际上，交易信息是所有加密货币的价值所在。除此以外，区块还包含了一些技术实现的相关信息，比如版本，当前时间戳和前一个区块的哈希。
+不过，我们要实现的是一个简化版的区块链，而不是一个像比特币技术规范所描述那样成熟完备的区块链。所以在我们目前的实现中，区块仅包含了部分关键信息，它的数据结构如下：
+*/
+//区块的数据结构
+type Block struct {
+	Timestamp     int64  //当前时间戳
+	Data          []byte //区块实际存储的信息
+	PrevBlockHash []byte //前一个块的哈希
+	Hash          []byte //当前块的哈希
+	Nonce         int    //在对工作量证明进行验证时用到
+}
+
+// 用于生成新块，Hash 和 Nonce 要等挖矿（见 pow 包）以后才有
+func New(data string, prevBlockHash []byte) *Block {
+	return &Block{time.Now().Unix(), []byte(data), prevBlockHash, []byte{}, 0}
+}
+
+/**
+在我们的简化版区块中，还有一个 Hash 字段，那么，要如何计算哈希呢？哈希计算，是区块链一个非常重要的部分。正是由于它，才保证了区块链的安全。计算一个哈希，是在计算上非常困难的一个操作。即使在高速电脑上，也要耗费很多时间 (这就是为什么人们会购买 GPU，FPGA，ASIC 来挖比特币) 。这是一个架构上有意为之的设计，它故意使得加入新的区块十分困难，继而保证区块一旦被加入以后，就很难再进行修改。在接下来的内容中，我们将会讨论和实现这个机制。
+目前，我们仅取了 Block 结构的部分字段（Timestamp, Data 和 PrevBlockHash），并将它们相互拼接起来，然后在拼接后的结果上计算一个 SHA-256，然后就得到了哈希。把这个功能用以下的SetHash函数来实现。
+*/
+//设置当前块哈希
+// Hash=sha256(PrevBlockHash+Data+Timestamp)
+func (b *Block) SetHash() {
+	timestamp := []byte(strconv.FormatInt(b.Timestamp, 10))
+	headers := bytes.Join([][]byte{b.PrevBlockHash, b.Data, timestamp}, []byte{})
+	hash := sha256.Sum256(headers)
+
+	b.Hash = hash[:]
+}
+
+//用于生成新块
+//当前块的哈希会基于传入的参数Data 和PrevBlockHash计算得到
+//func NewBlock(data string, prevBlockHash []byte) *Block {
+//	block := &Block{
+//		Timestamp:		time.Now().Unix(),
+//		PrevBlockHash:	prevBlockHash,
+//		Hash:			[]byte{},
+//		Data:			[]byte(data) }
+//
+//	block.SetHash()
+//	return block
+//}
+
+// 将block序列化为一个字节数组，这是一个方法
+func (b Block) Serialize() ([]byte, error) {
+	var result bytes.Buffer //Buffer用来存储序列化之后的数据
+	// result:=new(bytes.Buffer)//分配内存,这是另一种写法，若用这种写法，则创建编码器时应该传入对象而不是地址
+
+	encoder := gob.NewEncoder(&result) //创建基于buf内存的编码器
+
+	err := encoder.Encode(b) //使用编码器对block结构体进行编码
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil //结果作为一个字节数组返回
+}
+
+// 将字节数组反序列化为一个Block，这是一个单独的函数，数据损坏时返回的错误包含 ErrCorrupt
+// 存储中压缩过的块要先由 store 包解压
+func Deserialize(d []byte) (*Block, error) {
+	var block Block
+	derusult := bytes.NewBuffer(d)      //使用result里面的数据创建初始化Buffer
+	decoder := gob.NewDecoder(derusult) //	创建解码器
+	//decoder := gob.NewDecoder(bytes.NewReader(d))  //这是另一种写法，创建解码器，传入的是d字节数组的Reader
+	err := decoder.Decode(&block) //对于d内容解码，并将解码后的内容写入变量block的内存中
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	return &block, nil
+}
+
+// 将一个 int64 转化为一个字节数组（byte array），8 字节大端序
+// 原来用 binary.Write 写入 bytes.Buffer，它理论上会返回错误；直接写入定长数组就不会失败了
+func IntToHex(num int64) []byte {
+	buff := make([]byte, 8)
+	binary.BigEndian.PutUint64(buff, uint64(num))
+
+	return buff
+}
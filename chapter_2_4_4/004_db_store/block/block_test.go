@@ -0,0 +1,64 @@
+package block
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSerializeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		block Block
+	}{
+		{"genesis", Block{Timestamp: 1700000000, Data: []byte("Genesis Block1"), PrevBlockHash: []byte{}, Hash: []byte{0, 1, 2}}},
+		{"with parent", Block{Timestamp: 1700000060, Data: []byte("send 1BTC to Pig"), PrevBlockHash: bytes.Repeat([]byte{0xab}, 32),
+			Hash: bytes.Repeat([]byte{0xcd}, 32), Nonce: 12345}},
+		{"empty data", Block{Timestamp: 1, PrevBlockHash: []byte{1}, Hash: []byte{2}}}, //裁剪过的块没有区块体
+		{"binary data", Block{Timestamp: -1, Data: []byte{0, 0xff, '\n', 0}, Nonce: 1 << 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serialized, err := tt.block.Serialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Deserialize(serialized)
+			if err != nil {
+				t.Fatal(err)
+			}
+			//gob 不区分 nil 和空切片
+			if got.Timestamp != tt.block.Timestamp || got.Nonce != tt.block.Nonce || !bytes.Equal(got.Data, tt.block.Data) ||
+				!bytes.Equal(got.PrevBlockHash, tt.block.PrevBlockHash) || !bytes.Equal(got.Hash, tt.block.Hash) {
+				t.Errorf("Deserialize(Serialize(%+v)) = %+v", tt.block, *got)
+			}
+		})
+	}
+}
+
+func TestDeserializeCorrupt(t *testing.T) {
+	serialized, err := Block{Timestamp: 1700000000, Data: []byte("data"), Hash: []byte{1}}.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"garbage", []byte("not a gob stream")},
+		{"truncated", serialized[:len(serialized)/2]},
+		{"gzip header", []byte{0x1f, 0x8b, 8, 0}}, //没有先解压的块
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Deserialize(tt.data)
+			if !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Deserialize(%x) error = %v, want ErrCorrupt", tt.data, err)
+			}
+		})
+	}
+}
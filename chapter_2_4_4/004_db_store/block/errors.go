@@ -0,0 +1,38 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+)
+
+//==========================================错误===========================================
+/**
+原来的代码遇到任何错误都 log.Panic，嵌入到别的服务里时会让整个进程崩溃。
+现在导出的函数都返回 error，常见的错误是下面这些哨兵值，调用者用 errors.Is 判断种类，用 errors.As 取出 *block.Error 得到出错的区块：
+1.store.ErrBlockNotFound：存储中没有这个块
+2.block.ErrCorrupt：区块数据无法解压或解码
+3.store.ErrCorruptDatabase、store.ErrMissingBucket：文件不是一个有效的 bolt 数据库，或者缺少必需的 bucket
+4.pow.ErrInvalid：工作量证明无效，或者哈希与区块内容不符
+5.block.ErrInvalid、chain.ErrUnknownGenesis、chain.ErrBrokenAncestors：区块不能加入链中
+6.store.ErrChainLocked：链文件被另一个进程打开
+CLI 把这些错误映射为不同的退出码，见 cli 包中的 exitCode。
+*/
+
+var (
+	ErrCorrupt = errors.New("corrupt block encoding")
+	ErrInvalid = errors.New("invalid block")
+)
+
+// Error 是和某一个区块有关的错误
+type Error struct {
+	Hash []byte
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("block %x: %v", e.Hash, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,198 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================备份与恢复===========================================
+/**
+CLI 正在写入时直接拷贝 db/blockchain.db，可能拷贝到写了一半的文件。
+Backup 交给 store.BoltStore.Backup，在一个 bolt 读事务中写出一个一致的快照，备份期间其他写入不受影响。
+备份文件本身就是一个完整的 bolt 文件，包括区块、元数据和所有索引。
+Restore 不会直接覆盖链文件：
+1.先把备份拷贝到链文件旁边的 <chain>.db.restore
+2.只读地打开这个临时文件，用 Verify 校验整条链，有任何问题就删除临时文件并返回校验报告。
+  校验不经过 New，不会迁移、不会写入任何东西：校验的就是将要换上去的文件本身。数据库版本不是最新的备份直接拒绝，
+  需要先在一个副本上运行 migrate
+3.校验通过后锁住原来的链文件（确认没有别的进程在使用），把它改名为 <chain>.db.old，再把临时文件改名为链文件。
+  锁只是 store.LockFile 加的文件锁，不读取内容，损坏的链文件也能被替换
+4.已经有 <chain>.db.old（上一次恢复留下的）时拒绝恢复，不会覆盖它；
+  临时文件换不上去时把 .old 改回链文件，连这一步也失败时返回 ErrRestoreIncomplete，说明链文件现在的位置
+*/
+
+const (
+	restoreSuffix = ".restore"
+	oldSuffix     = ".old"
+)
+
+var (
+	ErrBackupUnsupported = errors.New("backup is only available for bolt databases")
+	ErrBackupEmpty       = errors.New("backup contains no chain")
+	ErrBackupInvalid     = errors.New("backup failed verification")
+	ErrBackupOutdated    = errors.New("backup uses an older database schema")
+	ErrRestoreOldExists  = errors.New("the file kept by a previous restore is still there, move or delete it first")
+	ErrRestoreIncomplete = errors.New("restore failed after moving the chain file aside")
+)
+
+// 测试中替换，模拟改名失败
+var rename = os.Rename
+
+// 把区块链的一个一致的副本写入 w，返回写入的字节数
+func (bc *Blockchain) Backup(w io.Writer) (int64, error) {
+	s, ok := bc.boltStore()
+	if !ok {
+		return 0, ErrBackupUnsupported
+	}
+
+	return s.Backup(w)
+}
+
+// 校验备份文件并用它替换 path 处的链文件，返回校验报告；校验不通过时返回 ErrBackupInvalid，链文件保持不变
+// 校验使用 cfg 中的难度、口令和 bucket 名，备份必须和链文件使用同一个 bucket
+func Restore(backup, path string, cfg Config) (*VerifyReport, error) {
+	old := path + oldSuffix
+	err := checkNoOldFile(old)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := path + restoreSuffix
+	err = copyFile(backup, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	report, err := verifyChainFile(tmp, cfg)
+	if err == nil && !report.OK() {
+		err = ErrBackupInvalid
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return report, err
+	}
+
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = rename(tmp, path)
+		if err != nil {
+			os.Remove(tmp)
+		}
+		return report, err
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return report, err
+	}
+
+	//锁住原来的链文件，保证替换时没有别的进程打开它。它可能已经损坏，所以只加锁、不校验内容
+	unlock, err := store.LockFile(path)
+	if err != nil {
+		os.Remove(tmp)
+		return report, err
+	}
+	defer unlock()
+
+	err = checkNoOldFile(old)
+	if err == nil {
+		err = rename(path, old)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return report, err
+	}
+	err = rename(tmp, path)
+	if err == nil {
+		return report, nil
+	}
+
+	//换不上去时把原来的链文件改回去，改不回去就如实报告它现在在哪里
+	os.Remove(tmp)
+	if rollbackErr := rename(old, path); rollbackErr != nil {
+		return report, fmt.Errorf("%w: the chain file is now %s (%v, moving it back: %v)", ErrRestoreIncomplete, old, err, rollbackErr)
+	}
+
+	return report, err
+}
+
+// 恢复不会覆盖上一次恢复留下的 .old 文件
+func checkNoOldFile(old string) error {
+	_, err := os.Lstat(old)
+	if err == nil {
+		return fmt.Errorf("%w: %s", ErrRestoreOldExists, old)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// 只读地打开一个链文件并完整校验它，文件不会被修改
+func verifyChainFile(path string, cfg Config) (*VerifyReport, error) {
+	s, err := store.OpenBoltStoreReadOnly(path, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a usable chain database: %w", path, err)
+	}
+	defer s.Close()
+
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > store.LatestSchemaVersion {
+		return nil, fmt.Errorf("%w: backup is version %d, latest known is %d", store.ErrSchemaTooNew, version, store.LatestSchemaVersion)
+	}
+	if version < store.LatestSchemaVersion {
+		return nil, fmt.Errorf("%w: version %d, this program restores version %d; run migrate on a copy of the backup first",
+			ErrBackupOutdated, version, store.LatestSchemaVersion)
+	}
+
+	tip, err := s.GetTip()
+	if err != nil {
+		return nil, err
+	}
+	if tip == nil {
+		return nil, ErrBackupEmpty
+	}
+	if cfg.Passphrase != "" && s.Encrypted() {
+		err = s.Unlock(cfg.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bc, err := readOnlyChain(s, tip, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.Verify()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
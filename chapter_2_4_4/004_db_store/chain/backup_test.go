@@ -0,0 +1,339 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 打开 path 处的链文件，必要时先追加几个块，返回关闭前的 tip
+func writeChainFile(t *testing.T, path string, data ...string) []byte {
+	t.Helper()
+	s, err := store.NewBoltStore(path, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	bc := newTestChain(t, s)
+	for _, d := range data {
+		mustAddBlocks(t, bc, d)
+	}
+
+	return bc.Tip()
+}
+
+// 备份 path 处的链文件，返回备份文件的路径
+func backupChainFile(t *testing.T, path string) string {
+	t.Helper()
+	s, err := store.NewBoltStore(path, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var buf bytes.Buffer
+	if _, err := newTestChain(t, s).Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	backup := path + ".bak"
+	if err := os.WriteFile(backup, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return backup
+}
+
+func storedTip(t *testing.T, path string) []byte {
+	t.Helper()
+	s, err := store.NewBoltStore(path, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tip, err := s.GetTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tip
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chain.db")
+	backedUp := writeChainFile(t, path, "one", "two")
+	backup := backupChainFile(t, path)
+	newer := writeChainFile(t, path, "three")
+
+	report, err := Restore(backup, path, testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Blocks != 3 {
+		t.Errorf("restore report: %d blocks, problems %v", report.Blocks, report.Problems)
+	}
+	if tip := storedTip(t, path); !bytes.Equal(tip, backedUp) {
+		t.Errorf("tip after restore = %x, want the backed up tip %x", tip, backedUp)
+	}
+	//原来的链文件改名保留下来
+	if tip := storedTip(t, path+oldSuffix); !bytes.Equal(tip, newer) {
+		t.Errorf("tip of %s = %x, want %x", path+oldSuffix, tip, newer)
+	}
+	if _, err := os.Stat(path + restoreSuffix); !os.IsNotExist(err) {
+		t.Errorf("temporary restore file was left behind: %v", err)
+	}
+
+	//链文件不存在时直接放到那里
+	fresh := filepath.Join(dir, "fresh.db")
+	if _, err := Restore(backup, fresh, testConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	if tip := storedTip(t, fresh); !bytes.Equal(tip, backedUp) {
+		t.Errorf("tip of restored new file = %x, want %x", tip, backedUp)
+	}
+}
+
+// 校验不通过的备份不能替换链文件，也不能留下临时文件
+func TestRestoreRejected(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chain.db")
+	tip := writeChainFile(t, path, "one")
+	backup := backupChainFile(t, path)
+
+	tampered := filepath.Join(dir, "tampered.bak")
+	if err := copyFile(backup, tampered); err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(tampered, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("blocks"))
+		blk, err := block.Deserialize(b.Get(tip))
+		if err != nil {
+			return err
+		}
+		blk.Data = []byte("forged")
+		encoded, err := blk.Serialize()
+		if err != nil {
+			return err
+		}
+		return b.Put(tip, encoded)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	garbage := filepath.Join(dir, "garbage.bak")
+	if err := os.WriteFile(garbage, bytes.Repeat([]byte("x"), 8192), 0600); err != nil {
+		t.Fatal(err)
+	}
+	//新建的 bolt 文件还没有记录数据库版本；记录上最新的版本号以后，它是一个没有链的空数据库
+	outdated := filepath.Join(dir, "outdated.bak")
+	s, err := store.NewBoltStore(outdated, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	empty := filepath.Join(dir, "empty.bak")
+	s, err = store.NewBoltStore(empty, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.PutMeta("version", block.IntToHex(int64(store.LatestSchemaVersion)))
+	s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		backup string
+		err    error //nil 表示只要求返回错误
+	}{
+		{"tampered", tampered, ErrBackupInvalid},
+		{"empty", empty, ErrBackupEmpty},
+		{"outdated", outdated, ErrBackupOutdated},
+		{"garbage", garbage, nil},
+		{"missing", filepath.Join(dir, "missing.bak"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Restore(tt.backup, path, testConfig(t))
+			if err == nil {
+				t.Fatal("restore succeeded, want an error")
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			if got := storedTip(t, path); !bytes.Equal(got, tip) {
+				t.Errorf("chain file was changed: tip %x, want %x", got, tip)
+			}
+			for _, suffix := range []string{restoreSuffix, oldSuffix} {
+				if _, err := os.Stat(path + suffix); !os.IsNotExist(err) {
+					t.Errorf("%s exists after a failed restore", path+suffix)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupUnsupported(t *testing.T) {
+	bc := newTestChain(t, store.NewMemoryStore())
+	if _, err := bc.Backup(&bytes.Buffer{}); !errors.Is(err, ErrBackupUnsupported) {
+		t.Errorf("Backup of a memory chain: err = %v, want ErrBackupUnsupported", err)
+	}
+}
+
+// 替换链文件这一步：损坏的链文件、被占用的链文件、已有的 .old 文件以及改名失败
+func TestRestoreReplace(t *testing.T) {
+	fail := errors.New("rename failed")
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, path string) //在备份之后、恢复之前改动链文件
+		failures  int                             //改名为链文件时前几次失败：先是换上临时文件，然后是把 .old 改回去
+		err       error
+		restored  bool   //链文件是否换成了备份
+		oldExists bool   //恢复之后是否留下 .old
+		moved     string //原来的链文件改名后的后缀，"" 表示还在原处
+	}{
+		{"corrupt chain file", func(t *testing.T, path string) {
+			if err := os.WriteFile(path, bytes.Repeat([]byte("x"), 8192), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}, 0, nil, true, true, oldSuffix},
+		{"old file exists", func(t *testing.T, path string) {
+			if err := os.WriteFile(path+oldSuffix, []byte("kept"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}, 0, ErrRestoreOldExists, false, true, ""},
+		{"rolled back", nil, 1, fail, false, false, ""},
+		{"rollback failed", nil, 2, ErrRestoreIncomplete, false, true, oldSuffix},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "chain.db")
+			backedUp := writeChainFile(t, path, "one")
+			backup := backupChainFile(t, path)
+			writeChainFile(t, path, "two")
+			before, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				tt.setup(t, path)
+				before, _ = os.ReadFile(path)
+			}
+			failures := tt.failures
+			rename = func(from, to string) error {
+				if to == path && failures > 0 {
+					failures--
+					return fail
+				}
+				return os.Rename(from, to)
+			}
+			defer func() { rename = os.Rename }()
+
+			_, err = Restore(backup, path, testConfig(t))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Restore error = %v, want %v", err, tt.err)
+			}
+			if _, err := os.Stat(path + restoreSuffix); !os.IsNotExist(err) {
+				t.Errorf("temporary restore file was left behind: %v", err)
+			}
+			if _, err := os.Stat(path + oldSuffix); (err == nil) != tt.oldExists {
+				t.Errorf("%s exists = %v, want %v", path+oldSuffix, err == nil, tt.oldExists)
+			}
+			if tt.err == ErrRestoreIncomplete && !strings.Contains(err.Error(), path+oldSuffix) {
+				t.Errorf("error %q does not say where the chain file is", err)
+			}
+			if tt.restored {
+				if tip := storedTip(t, path); !bytes.Equal(tip, backedUp) {
+					t.Errorf("tip after restore = %x, want %x", tip, backedUp)
+				}
+			}
+			//原来的链文件原样保留在原处或者 .old
+			kept, err := os.ReadFile(path + tt.moved)
+			if err != nil || !bytes.Equal(kept, before) {
+				t.Errorf("%s does not hold the original chain file (%v)", path+tt.moved, err)
+			}
+		})
+	}
+}
+
+// 别的进程打开着链文件时不能替换它
+func TestRestoreLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	writeChainFile(t, path, "one")
+	backup := backupChainFile(t, path)
+	s, err := store.NewBoltStore(path, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, err = Restore(backup, path, testConfig(t))
+	if !errors.Is(err, store.ErrChainLocked) {
+		t.Errorf("Restore error = %v, want store.ErrChainLocked", err)
+	}
+	for _, suffix := range []string{restoreSuffix, oldSuffix} {
+		if _, err := os.Stat(path + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s exists after a failed restore", path+suffix)
+		}
+	}
+}
+
+// 区块不在默认 bucket 中的链，恢复时校验的也是配置的 bucket
+func TestRestoreOtherBucket(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(t)
+	cfg.DataDir, cfg.Chain, cfg.Bucket = dir, "other", "chain"
+	bc, err := Create(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustAddBlocks(t, bc, "one")
+	tip := bc.Tip()
+	var buf bytes.Buffer
+	_, err = bc.Backup(&buf)
+	bc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(dir, "other.bak")
+	if err := os.WriteFile(backup, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "restored.db")
+	if _, err := Restore(backup, path, testConfig(t)); err == nil {
+		t.Error("restore with the default bucket succeeded, want an error")
+	}
+	report, err := Restore(backup, path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Blocks != 2 {
+		t.Errorf("restore report: %d blocks, problems %v", report.Blocks, report.Problems)
+	}
+	s, err := store.NewBoltStore(path, cfg.Bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, err := s.GetTip(); err != nil || !bytes.Equal(got, tip) {
+		t.Errorf("restored tip = %x (%v), want %x", got, err, tip)
+	}
+}
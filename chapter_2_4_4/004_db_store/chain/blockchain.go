@@ -0,0 +1,391 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/pow"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 区块链的结构体
+// tip这个词本身有事物尖端或尾部的意思，这里指的是存储最后一个块的哈希
+// store 是区块的存储后端（见 store 包）
+type Blockchain struct {
+	tip []byte
+	/**
+	存储了一个存储后端。因为我们想要一旦打开它的话，就让它一直运行，直到程序运行结束。因此，Blockchain 的结构现在是这样：
+	不在里面存储所有的区块了，而是仅存储区块链的 tip，区块本身交给 BoltStore（数据库）或 MemoryStore（内存）保存
+	*/
+	store store.BlockStore
+
+	targetBits int          //挖矿难度
+	maxNonce   int          //挖矿时最多尝试的 nonce 个数
+	hashName   string       //挖矿使用的哈希算法，见 genesis.go
+	hash       pow.HashFunc //hashName 对应的哈希函数
+	log        io.Writer    //挖矿进度等输出
+
+	mu             sync.Mutex     //保护下面这些内存状态以及 tip，多个 goroutine 可以同时调用 AddBlock
+	heights        map[string]int //已经算出的区块高度，见 fork.go
+	orphans        *orphanPool    //父块还没到达的块
+	indexes        []ChainIndex   //随主链变化而更新的派生索引
+	reorgListeners []func(ReorgEvent)
+	pruneDepth     int //裁剪深度，0 表示不裁剪，见 prune.go
+}
+
+// Config 是打开一条区块链需要的配置，原来这些都是写死的全局常量
+type Config struct {
+	DataDir    string    //数据目录，链文件为 <DataDir>/<Chain>.db
+	Chain      string    //链的名字
+	Bucket     string    //链文件中区块所在的 bucket，默认是原来的 "blocks"
+	CacheSize  int       //区块缓存的容量，0 表示不使用缓存
+	Passphrase string    //加密的链的口令，为空时只能读取区块头
+	TargetBits int       //挖矿难度，哈希的前 TargetBits 位必须是 0，0 表示默认难度，链在元数据中记录了难度时以记录的为准
+	MaxNonce   int       //挖矿时最多尝试的 nonce 个数，0 表示不限制
+	Log        io.Writer //挖矿进度等输出，nil 表示不输出
+	Genesis    *Genesis  //新建链时使用的创世块，nil 表示默认的创世块，见 genesis.go
+}
+
+// 配置的难度，0 时使用默认难度，不在 1 到 255 之间时返回 pow.ErrTargetBits
+func (cfg Config) targetBits() (int, error) {
+	if cfg.TargetBits == 0 {
+		return pow.DefaultTargetBits, nil
+	}
+
+	return cfg.TargetBits, pow.CheckTargetBits(cfg.TargetBits)
+}
+
+// 默认配置：db/blockchain.db，带缓存，默认难度，不输出
+func DefaultConfig() Config {
+	return Config{
+		DataDir:    "db",
+		Chain:      "blockchain",
+		Bucket:     store.DefaultBucket,
+		CacheSize:  store.DefaultCacheSize,
+		TargetBits: pow.DefaultTargetBits,
+		MaxNonce:   pow.DefaultMaxNonce,
+	}
+}
+
+/**
+有了区块，下面让我们来实现区块链。本质上，区块链就是一个有着特定结构的数据库，是一个有序，每一个块都连接到前一个块的链表。也就是说，区块按照插入的顺序进行存储，每个块都与前一个块相连。这样的结构，能够让我们快速地获取链上的最新块，并且高效地通过哈希来检索一个块。
+在 Golang 中，可以通过一个 array 和 map 来实现这个结构：array 存储有序的哈希（Golang 中 array 是有序的），map 存储 hash -> block 对(Golang 中, map 是无序的)。 但是在基本的原型阶段，我们只用到了 array，因为现在还不需要通过哈希来获取块。
+*/
+//第一个区块链————这是一个Block 指针数组
+//type Blockchain struct {
+//	blocks []*Block
+//}
+
+//现在，让我们能够给它添加一个区块：
+//添加区块
+//data就是交易
+//func (bc *Blockchain) AddBlock(data string) {
+//	prevBlock := bc.blocks[len(bc.blocks)-1]
+//	newBlock := NewBlock(data, prevBlock.Hash)
+//	bc.blocks = append(bc.blocks, newBlock)
+//}
+
+/**
+为了加入一个新的块，我们必须要有一个已有的块，但是，初始状态下，我们的链是空的，一个块都没有！所以，在任何一个区块链中，都必须至少有一个块。这个块，也就是链中的第一个块，通常叫做创世块（genesis block）
+*/
+//创世区块中存储的信息
+const genesisData = "Genesis Block1"
+
+// 挖出一个新块，难度、nonce 上限和进度输出取自区块链的配置
+func (bc *Blockchain) newBlock(data string, prevBlockHash []byte) (*block.Block, error) {
+	newBlock := block.New(data, prevBlockHash)
+	err := bc.Proof(newBlock).Mine(bc.log)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBlock, nil
+}
+
+//==========================================区块链检查===========================================
+/**
+现在，产生的所有块都会被保存到一个数据库里面，所以我们可以重新打开一个链，然后向里面加入新块。但是在实现这一点后，我们失去了之前一个非常好的特性：再也无法打印区块链的区块了，因为现在不是将区块存储在一个数组，而是放到了数据库里面。让我们来解决这个问题！
+BoltDB 允许对一个 bucket 里面的所有 key 进行迭代，但是所有的 key 都以字节序进行存储，而且我们想要以区块能够进入区块链中的顺序进行打印。此外，因为我们不想将所有的块都加载到内存中（因为我们的区块链数据库可能很大！或者现在可以假装它可能很大），我们将会一个一个地读取它们。故而，我们需要一个区块链迭代器（BlockchainIterator）：
+*/
+//区块链迭代器的结构体
+type BlockchainIterator struct {
+	currentHash []byte
+	store       store.BlockStore
+}
+
+/**
+每当要对链中的块进行迭代时，我们就会创建一个迭代器，里面存储了当前迭代的块哈希（currentHash）和存储后端（store）。通过 store，迭代器逻辑上被附属到一个区块链上（这里的区块链指的是持有一个存储后端的 Blockchain 实例），并且通过 Blockchain 方法进行创建：
+*/
+
+// Blockchain中的迭代器方法 ...
+func (bc *Blockchain) Iterator() *BlockchainIterator {
+	bci := &BlockchainIterator{bc.Tip(), bc.store}
+
+	return bci //返回一个区块链迭代器的指针
+}
+
+/**
+注意，迭代器的初始状态为链中的 tip，因此区块将从尾到头（创世块为头），也就是从最新的到最旧的进行获取。实际上，选择一个 tip 就是意味着给一条链“投票”。一条链可能有多个分支，最长的那条链会被认为是主分支。在获得一个 tip （可以是链中的任意一个块）之后，我们就可以重新构造整条链，找到它的长度和需要构建它的工作。这同样也意味着，一个 tip 也就是区块链的一种标识符。
+BlockchainIterator 只会做一件事情：返回链中的前一个块。
+*/
+// 区块链迭代器的唯一功能：返回链中的前一个块，走过创世块以后返回 nil, nil
+func (i *BlockchainIterator) Next() (*block.Block, error) {
+	if len(i.currentHash) == 0 {
+		return nil, nil
+	}
+
+	b, err := i.store.GetBlock(i.currentHash) //取出当前哈希这个键所对应的块
+	if err != nil {
+		return nil, &block.Error{Hash: i.currentHash, Err: err}
+	}
+
+	i.currentHash = b.PrevBlockHash //把前一个块的哈希赋给迭代器中的“当前哈希”，也就是往上迭代
+
+	return b, nil
+}
+
+/**
+1.打开一个数据库文件
+2.检查文件里面是否已经存储了一个区块链
+3.如果已经存储了一个区块链：
+——1.创建一个新的 Blockchain 实例
+——2.设置 Blockchain 实例的 tip 为数据库中存储的最后一个块的哈希
+4.如果没有区块链：
+——1.创建创世块
+——2.存储到数据库
+——3.将创世块哈希保存为最后一个块的哈希
+——4.创建一个新的 Blockchain 实例，初始时 tip 指向创世块（tip 有尾部，尖端的意思，在这里 tip 存储的是最后一个块的哈希）
+*/
+
+// 打开 cfg 指定的链文件（不存在时创建一条带有创世区块的新链），按配置解锁加密的区块体并加上缓存
+func Open(cfg Config) (*Blockchain, error) {
+	path, err := store.ChainPath(cfg.DataDir, cfg.Chain)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := store.NewBoltStore(path, cfg.Bucket) //这是打开一个BoltDB文件的标准做法。注意，即便不存在这样的文件，它也不会返回错误
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Passphrase != "" && s.Encrypted() {
+		err = s.Unlock(cfg.Passphrase)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	var backend store.BlockStore = s
+	if cfg.CacheSize > 0 {
+		backend = store.NewCachedStore(s, cfg.CacheSize)
+	}
+	bc, err := New(backend, cfg)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+// 只读打开的链文件使用旧的数据库版本，缺少高度索引等新版本才有的数据
+var ErrNeedsMigration = errors.New("chain database uses an older schema, open it for writing once to migrate it")
+
+// 只读地打开 cfg 指定的已有链文件：不创建链、不迁移、不写入任何东西，只和写入的进程互斥，多个只读的进程可以同时打开。
+// 用于只看不改的场景，例如 printchain -follow 的每次检查
+func OpenReadOnly(cfg Config) (*Blockchain, error) {
+	path, err := store.ChainPath(cfg.DataDir, cfg.Chain)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := store.OpenBoltStoreReadOnly(path, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	bc, err := newReadOnly(path, s, cfg)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+func newReadOnly(path string, s *store.BoltStore, cfg Config) (*Blockchain, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > store.LatestSchemaVersion {
+		return nil, fmt.Errorf("%w: %s is version %d, latest known is %d", store.ErrSchemaTooNew, path, version, store.LatestSchemaVersion)
+	}
+	if version < store.LatestSchemaVersion {
+		return nil, fmt.Errorf("%w: %s is version %d", ErrNeedsMigration, path, version)
+	}
+	if cfg.Passphrase != "" && s.Encrypted() {
+		err = s.Unlock(cfg.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tip, err := s.GetTip()
+	if err != nil {
+		return nil, err
+	}
+	if tip == nil {
+		return nil, fmt.Errorf("%s contains no chain: %w", path, store.ErrBlockNotFound)
+	}
+
+	return readOnlyChain(s, tip, cfg)
+}
+
+// 和 New 一样读取链的参数，但不创建创世块、不迁移、不加载要写入的索引
+func readOnlyChain(s store.BlockStore, tip []byte, cfg Config) (*Blockchain, error) {
+	targetBits, err := cfg.targetBits()
+	if err != nil {
+		return nil, err
+	}
+	bc := &Blockchain{tip: tip, store: s, maxNonce: cfg.MaxNonce, log: io.Discard, heights: make(map[string]int), orphans: newOrphanPool()}
+	err = bc.loadParams(targetBits)
+	if err != nil {
+		return nil, err
+	}
+
+	return bc, nil
+}
+
+// 在任意存储后端上创建区块链：如果存储中还没有区块链，就先写入创世块；
+// 存储支持迁移（BoltStore）时，再把它升级到最新的数据库版本。cfg 中只用到 TargetBits、MaxNonce、Log 和 Genesis
+func New(s store.BlockStore, cfg Config) (*Blockchain, error) {
+	targetBits, err := cfg.targetBits()
+	if err != nil {
+		return nil, err
+	}
+	tip, err := s.GetTip()
+	if err != nil {
+		return nil, err
+	}
+
+	bc := Blockchain{tip: tip, store: s, maxNonce: cfg.MaxNonce, log: cfg.Log, heights: make(map[string]int), orphans: newOrphanPool()} //这是创建Blockchain的一个新方式
+	if bc.log == nil {
+		bc.log = io.Discard
+	}
+	bc.AddIndex(heightIndex{s})
+
+	created := false
+	if tip == nil { //如果存储中不存在区块链(没有最后一个块的哈希)，那么就创建一个，否则直接使用最后一个块的哈希
+		fmt.Fprintln(bc.log, "No existing blockchain found. Creating a new one...")
+		genesis := cfg.Genesis
+		if genesis == nil {
+			genesis = defaultGenesis(targetBits)
+		}
+
+		created, err = bc.createGenesis(genesis)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			//同时有别人在这个存储上创建了链，使用别人的创世块
+			bc.tip, err = s.GetTip()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !created { //已有的链使用它自己记录的参数
+		err = bc.loadParams(targetBits)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//链重组后，被断开的块从缓存中移除
+	if c, ok := s.(*store.CachedStore); ok {
+		bc.OnReorg(func(e ReorgEvent) {
+			for _, b := range e.Disconnected {
+				c.Invalidate(b.Hash)
+			}
+		})
+	}
+
+	if m, ok := s.(store.Migrator); ok {
+		_, err = m.Migrate(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bc.pruneDepth, err = bc.metaInt(pruneDepthKey, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	search, err := bc.SearchEnabled()
+	if err != nil {
+		return nil, err
+	}
+	if search {
+		bc.AddIndex(searchIndex{s})
+	}
+
+	return &bc, nil
+}
+
+// 关闭底层的存储后端
+func (bc *Blockchain) Close() error {
+	return bc.store.Close()
+}
+
+// 当前最后一个块的哈希
+func (bc *Blockchain) Tip() []byte {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.tip
+}
+
+// 挖矿和校验工作量时使用的难度
+func (bc *Blockchain) TargetBits() int {
+	return bc.targetBits
+}
+
+// 链的标识
+func (bc *Blockchain) ChainID() (string, error) {
+	id, err := bc.store.GetMeta(store.ChainIDKey)
+	return string(id), err
+}
+
+// 元数据中记录的创世块哈希，旧文件迁移之前为 nil
+func (bc *Blockchain) GenesisHash() ([]byte, error) {
+	return bc.store.GetMeta(store.GenesisHashKey)
+}
+
+// 加入区块时，需要将区块持久化到存储中
+// 挖矿很慢，不能在持有锁的时候进行：先记下当时的 tip 去挖矿，挖完以后如果 tip 已经被别人推进了，就在新的 tip 上重新挖
+func (bc *Blockchain) AddBlock(data string) (*block.Block, error) {
+	for {
+		lastHash := bc.Tip() //首先获取最后一个块的哈希用来生成新的哈希
+
+		newBlock, err := bc.newBlock(data, lastHash)
+		if err != nil {
+			return nil, err
+		}
+
+		//和收到的其他块一样经过 ProcessBlock，派生索引才能同步更新
+		_, err = bc.processIfTip(newBlock)
+		if err == errTipMoved {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return newBlock, nil
+	}
+}
@@ -0,0 +1,354 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/pow"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 测试用的难度，足够低，挖一个块只需要几十次哈希
+const testTargetBits = 4
+
+func testConfig(t *testing.T) Config {
+	cfg := DefaultConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.Chain = "test"
+	cfg.TargetBits = testTargetBits
+
+	return cfg
+}
+
+// 在临时目录中打开一个新的 bolt 文件，测试结束时关闭
+func newTestBoltStore(t *testing.T) *store.BoltStore {
+	t.Helper()
+	s, err := store.NewBoltStore(filepath.Join(t.TempDir(), "test.db"), store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// 需要覆盖每一种存储后端的测试用它来创建存储
+var backends = []struct {
+	name     string
+	newStore func(t *testing.T) store.BlockStore
+}{
+	{"memory", func(t *testing.T) store.BlockStore { return store.NewMemoryStore() }},
+	{"bolt", func(t *testing.T) store.BlockStore { return newTestBoltStore(t) }},
+	{"cached", func(t *testing.T) store.BlockStore { return store.NewCachedStore(store.NewMemoryStore(), 4) }},
+}
+
+// 在存储 s 上新建或打开一条测试难度的链
+func newTestChain(t *testing.T, s store.BlockStore) *Blockchain {
+	t.Helper()
+	bc, err := New(s, testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bc
+}
+
+// 挖出一个不入库的新块
+func mustNewBlock(t *testing.T, bc *Blockchain, data string, prev []byte) *block.Block {
+	t.Helper()
+	b, err := bc.newBlock(data, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// 在 MemoryStore 上新建一条只有创世块的链
+func newMemoryChain(t *testing.T) *Blockchain {
+	t.Helper()
+	return newTestChain(t, store.NewMemoryStore())
+}
+
+func mustHashAtHeight(t *testing.T, bc *Blockchain, height int) []byte {
+	t.Helper()
+	hash, err := bc.HashAtHeight(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+func mustAddBlocks(t *testing.T, bc *Blockchain, data ...string) {
+	t.Helper()
+	for _, d := range data {
+		_, err := bc.AddBlock(d)
+		if err != nil {
+			t.Fatalf("AddBlock(%q): %v", d, err)
+		}
+	}
+}
+
+// 主链上从 tip 往回走到创世块的区块，下标就是高度
+func mainChain(t *testing.T, bc *Blockchain) []*block.Block {
+	t.Helper()
+	var blocks []*block.Block
+	bci := bc.Iterator()
+	for {
+		blk, err := bci.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append([]*block.Block{blk}, blocks...)
+		if len(blk.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return blocks
+}
+
+// 从 tip 往回走到创世块，返回各块的数据，最新的在前
+func chainData(t *testing.T, bc *Blockchain) []string {
+	t.Helper()
+	var data []string
+	blocks := mainChain(t, bc)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		data = append(data, string(blocks[i].Data))
+	}
+
+	return data
+}
+
+// 同一套区块链逻辑在两种存储后端上的行为一致
+func TestBlockchainOnStores(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			s := backend.newStore(t)
+			bc := newTestChain(t, s)
+			mustAddBlocks(t, bc, "one")
+			mustAddBlocks(t, bc, "two")
+
+			want := []string{"two", "one", "Genesis Block1"}
+			got := chainData(t, bc)
+			if len(got) != len(want) {
+				t.Fatalf("chain = %q, want %q", got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("chain = %q, want %q", got, want)
+				}
+			}
+
+			for _, blk := range mainChain(t, bc) {
+				if !pow.New(blk, testTargetBits).Validate() {
+					t.Errorf("block %q: invalid proof of work", blk.Data)
+				}
+			}
+		})
+	}
+}
+
+// 重新打开 bolt 文件时不能再写一个创世块，而是接着原来的 tip
+func TestBoltReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := store.NewBoltStore(path, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := newTestChain(t, s)
+	mustAddBlocks(t, bc, "one")
+	tip := bc.tip
+	bc.Close()
+
+	s, err = store.NewBoltStore(path, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc = newTestChain(t, s)
+	defer bc.Close()
+	if !bytes.Equal(bc.tip, tip) {
+		t.Errorf("tip after reopen = %x, want %x", bc.tip, tip)
+	}
+	if got := chainData(t, bc); len(got) != 2 {
+		t.Errorf("chain after reopen = %q, want 2 blocks", got)
+	}
+}
+
+// 零值的 Config 使用默认难度，超出范围的难度在写入任何东西之前就被拒绝
+func TestNewTargetBits(t *testing.T) {
+	bc, err := New(store.NewMemoryStore(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.TargetBits() != pow.DefaultTargetBits {
+		t.Errorf("zero Config: target bits = %d, want the default %d", bc.TargetBits(), pow.DefaultTargetBits)
+	}
+	mustAddBlocks(t, bc, "one")
+
+	for _, targetBits := range []int{-1, 256, 1 << 20} {
+		s := store.NewMemoryStore()
+		_, err := New(s, Config{TargetBits: targetBits})
+		if !errors.Is(err, pow.ErrTargetBits) {
+			t.Errorf("New with target bits %d: error = %v, want pow.ErrTargetBits", targetBits, err)
+		}
+		if tip, _ := s.GetTip(); tip != nil {
+			t.Errorf("target bits %d: a genesis block was written", targetBits)
+		}
+		_, err = Import(s, bytes.NewReader(nil), Config{TargetBits: targetBits})
+		if !errors.Is(err, pow.ErrTargetBits) {
+			t.Errorf("Import with target bits %d: error = %v, want pow.ErrTargetBits", targetBits, err)
+		}
+	}
+}
+
+// 只读打开不改动链文件，可以同时打开多次，也不会新建链或者迁移旧文件
+func TestOpenReadOnly(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Log = nil
+	bc, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustAddBlocks(t, bc, "one", "two")
+	tip := bc.Tip()
+	bc.Close()
+	path, err := store.ChainPath(cfg.DataDir, cfg.Chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := OpenReadOnly(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := OpenReadOnly(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Tip(), tip) || mustHeight(t, second) != 2 {
+		t.Errorf("read-only chain: tip %x at height %d, want %x at height 2", first.Tip(), mustHeight(t, second), tip)
+	}
+	if got := chainData(t, first); len(got) != 3 {
+		t.Errorf("read-only chain = %q, want 3 blocks", got)
+	}
+	if _, err := first.AddBlock("three"); err == nil {
+		t.Error("AddBlock on a read-only chain succeeded")
+	}
+	first.Close()
+	second.Close()
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, before) {
+		t.Error("chain file was changed by a read-only open")
+	}
+
+	missing := cfg
+	missing.Chain = "missing"
+	if _, err := OpenReadOnly(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenReadOnly(missing) error = %v, want ErrNotExist", err)
+	}
+	if chains, _ := store.ListChains(cfg.DataDir); len(chains) != 1 {
+		t.Errorf("chains after opening a missing one read-only = %q, want only %q", chains, cfg.Chain)
+	}
+
+	//没有记录数据库版本的文件需要先迁移
+	outdated := cfg
+	outdated.Chain = "outdated"
+	path, err = store.ChainPath(cfg.DataDir, outdated.Chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.NewBoltStore(path, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if _, err := OpenReadOnly(outdated); !errors.Is(err, ErrNeedsMigration) {
+		t.Errorf("OpenReadOnly(outdated) error = %v, want ErrNeedsMigration", err)
+	}
+}
+
+// 多个 goroutine 同时在同一条链上 AddBlock：每个块都要接在主链上，不能有块因为 tip 被覆盖而丢失。
+// 用 go test -race 运行时同时检查数据竞争
+func TestConcurrentAddBlock(t *testing.T) {
+	const goroutines, perGoroutine = 8, 5
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			bc := newTestChain(t, backend.newStore(t))
+
+			var wg sync.WaitGroup
+			errs := make(chan error, goroutines*perGoroutine)
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < perGoroutine; i++ {
+						_, err := bc.AddBlock(fmt.Sprintf("goroutine %d block %d", g, i))
+						if err != nil {
+							errs <- err
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+
+			data := chainData(t, bc)
+			if len(data) != goroutines*perGoroutine+1 {
+				t.Fatalf("main chain has %d blocks, want %d", len(data), goroutines*perGoroutine+1)
+			}
+			seen := make(map[string]bool)
+			for _, d := range data {
+				if seen[d] {
+					t.Errorf("block %q is on the main chain twice", d)
+				}
+				seen[d] = true
+			}
+
+			report, err := bc.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() || report.Unreachable != 0 {
+				t.Errorf("verify: %d unreachable blocks, problems %v", report.Unreachable, report.Problems)
+			}
+		})
+	}
+}
+
+// 迭代器读不到块时返回错误，而不是 panic
+func TestIteratorMissingBlock(t *testing.T) {
+	s := store.NewMemoryStore()
+	bc := newTestChain(t, s)
+	orphan := mustNewBlock(t, bc, "orphan", []byte("nowhere"))
+	if err := s.PutBlock(orphan); err != nil {
+		t.Fatal(err)
+	}
+	bc.tip = orphan.Hash
+
+	bci := bc.Iterator()
+	if _, err := bci.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bci.Next(); !errors.Is(err, store.ErrBlockNotFound) {
+		t.Errorf("Next() past the orphan: err = %v, want store.ErrBlockNotFound", err)
+	}
+}
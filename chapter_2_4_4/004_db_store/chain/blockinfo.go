@@ -0,0 +1,115 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================单个区块的详细信息===========================================
+/**
+printchain 只能把整条链全部打印出来，要查看某一个块，需要知道的不只是区块本身的字段：
+1.它的高度、是否在主链上、主链上有多少个确认（tip 本身有 1 个确认，侧链上的块为 0）
+2.主链上它的下一个块，以及存储中所有以它为父块的块：分叉点有多个子块，其中最多一个在主链上
+3.工作量证明是否有效，区块体被裁剪或加密时只能检查哈希是否满足难度
+4.序列化后的大小
+*/
+
+// BlockInfo 是一个区块及其在链中的位置
+type BlockInfo struct {
+	Block         *block.Block
+	Height        int
+	MainChain     bool    //是否在主链上
+	Confirmations int     //tip 高度 - 高度 + 1，不在主链上时为 0
+	Next          []byte  //主链上的子块哈希，没有时为 nil
+	Children      []Child //存储中所有的子块，主链上的排在最前面，其余按哈希排序
+	HasBody       bool    //区块体是否可读，为 false 时 PoW 只检查了哈希是否满足难度
+	Pruned        bool    //区块体是被裁剪了（而不是被加密了）
+	PoWValid      bool
+	Serialized    []byte //Block.Serialize() 的结果，区块体不可读时不包含区块体
+}
+
+// Child 是一个子块的哈希以及它是否在主链上
+type Child struct {
+	Hash      []byte
+	MainChain bool
+}
+
+// 按哈希查询一个已存储的块，它可以不在主链上
+func (bc *Blockchain) BlockInfo(hash []byte) (*BlockInfo, error) {
+	b, err := bc.store.GetBlock(hash)
+	if err != nil {
+		return nil, &block.Error{Hash: hash, Err: err}
+	}
+
+	bc.mu.Lock()
+	height, err := bc.heightOf(hash)
+	var tipHeight int
+	if err == nil {
+		tipHeight, err = bc.heightOf(bc.tip)
+	}
+	bc.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &BlockInfo{Block: b, Height: height}
+	onMain, err := bc.HashAtHeight(height)
+	if err != nil && !errors.Is(err, store.ErrBlockNotFound) {
+		return nil, err
+	}
+	info.MainChain = bytes.Equal(onMain, hash)
+	if info.MainChain {
+		info.Confirmations = tipHeight - height + 1
+		if height < tipHeight {
+			info.Next, err = bc.HashAtHeight(height + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	//没有 父块 -> 子块 的索引，只能扫描全部区块
+	err = bc.scanBlocks(func(key []byte, child *block.Block, err error) error {
+		if err != nil || !bytes.Equal(child.PrevBlockHash, hash) {
+			return nil
+		}
+		info.Children = append(info.Children, Child{Hash: key, MainChain: bytes.Equal(key, info.Next)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(info.Children, func(i, j int) bool {
+		ci, cj := info.Children[i], info.Children[j]
+		if ci.MainChain != cj.MainChain {
+			return ci.MainChain
+		}
+		return bytes.Compare(ci.Hash, cj.Hash) < 0
+	})
+
+	info.Pruned, err = bc.store.IsPruned(hash)
+	if err != nil {
+		return nil, err
+	}
+	info.HasBody, err = bc.HasBody(hash)
+	if err != nil {
+		return nil, err
+	}
+	proof := bc.Proof(b)
+	if info.HasBody {
+		info.PoWValid = bytes.Equal(proof.Hash(), b.Hash) && proof.Validate()
+	} else {
+		info.PoWValid = proof.HashMeetsTarget()
+	}
+
+	info.Serialized, err = b.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
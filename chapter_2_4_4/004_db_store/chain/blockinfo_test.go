@@ -0,0 +1,101 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 主链 genesis a1 a2 a3，从 a1 分出侧链 b2：高度、确认数和子块都按块在哪条链上计算，
+// 子块列表包含侧链上的块
+func TestBlockInfo(t *testing.T) {
+	bc := newMemoryChain(t)
+	hashes := map[string][]byte{"genesis": bc.Tip()}
+	for _, step := range []struct{ name, parent string }{{"a1", "genesis"}, {"a2", "a1"}, {"a3", "a2"}, {"b2", "a1"}} {
+		b, _, err := bc.AddBlockOn(hashes[step.parent], step.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[step.name] = b.Hash
+	}
+
+	tests := []struct {
+		name          string
+		height        int
+		mainChain     bool
+		confirmations int
+		next          string   //主链上的子块，"" 表示没有
+		children      []string //存储中的子块，主链上的在前
+	}{
+		{"genesis", 0, true, 4, "a1", []string{"a1"}},
+		{"a1", 1, true, 3, "a2", []string{"a2", "b2"}}, //分叉点
+		{"a3", 3, true, 1, "", nil},                    //tip
+		{"b2", 2, false, 0, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := bc.BlockInfo(hashes[tt.name])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Height != tt.height || info.MainChain != tt.mainChain || info.Confirmations != tt.confirmations {
+				t.Errorf("height %d, main chain %v, %d confirmations; want %d, %v, %d",
+					info.Height, info.MainChain, info.Confirmations, tt.height, tt.mainChain, tt.confirmations)
+			}
+			if !bytes.Equal(info.Next, hashes[tt.next]) {
+				t.Errorf("next = %x, want %x", info.Next, hashes[tt.next])
+			}
+			if len(info.Children) != len(tt.children) {
+				t.Fatalf("%d children, want %d", len(info.Children), len(tt.children))
+			}
+			for i, name := range tt.children {
+				child := info.Children[i]
+				if !bytes.Equal(child.Hash, hashes[name]) || child.MainChain != (name == tt.next) {
+					t.Errorf("child %d = %x (main chain %v), want %s %x", i, child.Hash, child.MainChain, name, hashes[name])
+				}
+			}
+			if !info.HasBody || info.Pruned || !info.PoWValid {
+				t.Errorf("has body %v, pruned %v, PoW valid %v; want true, false, true", info.HasBody, info.Pruned, info.PoWValid)
+			}
+			serialized, err := info.Block.Serialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(info.Serialized, serialized) {
+				t.Error("Serialized does not match the stored block")
+			}
+		})
+	}
+}
+
+func TestBlockInfoInvalid(t *testing.T) {
+	bc := newMemoryChain(t)
+	b, err := bc.AddBlock("send 1BTC to Pig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//改动已存储的块以后，哈希和区块内容对不上
+	b.Data = []byte("send 1000BTC to Pig")
+	err = bc.store.PutBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := bc.BlockInfo(b.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.PoWValid {
+		t.Error("PoWValid = true for a tampered block")
+	}
+
+	_, err = bc.BlockInfo(bytes.Repeat([]byte{0xee}, 32))
+	var blockErr *block.Error
+	if !errors.As(err, &blockErr) || !errors.Is(err, store.ErrBlockNotFound) {
+		t.Errorf("BlockInfo(missing) error = %v, want a *block.Error wrapping store.ErrBlockNotFound", err)
+	}
+}
@@ -0,0 +1,430 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/pow"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================分叉与链重组===========================================
+/**
+原来的 AddBlock 只会在 "l" 指向的块后面接一个新块，同一高度上出现一个竞争的块时根本没有地方存放。
+现在所有区块都按哈希存进区块的 bucket（默认是 blocks），"l" 只是指向其中最好的那条链的末端：
+1.父块已知的块直接存储，它可能接在主链末尾，也可能在一条侧链（side branch）上
+2.父块未知的块放进孤块池（orphan pool），等父块到达后再处理
+3.一条侧链比主链更长（工作量更大）时，把 tip 切换过去，这就是链重组（reorganization）
+重组时先从旧 tip 往回断开（disconnect）到分叉点，再从分叉点往前连接（connect）到新 tip，
+注册在区块链上的派生索引会按同样的顺序回滚和重放，最后通知所有订阅了重组事件的回调。
+目前难度是固定的，每个块的工作量相同，所以“工作量更大”就等价于“高度更高”，高度相同时保留先到的链。
+*/
+
+// 孤块池最多保存的块数，超过后丢弃最早进入的孤块
+const maxOrphans = 100
+
+var (
+	errTipMoved        = errors.New("tip moved while the block was being processed") //只在包内使用，不会从公开的方法返回
+	ErrUnknownGenesis  = errors.New("block claims to be a genesis block of another chain")
+	ErrBrokenAncestors = errors.New("block ancestry does not reach the genesis block")
+)
+
+// ProcessBlock 处理一个块后的结果
+type BlockStatus int
+
+const (
+	BlockMainChain  BlockStatus = iota //接在主链末尾
+	BlockSideBranch                    //存储在一条侧链上，主链不变
+	BlockReorg                         //它所在的侧链变成了新的主链
+	BlockOrphan                        //父块未知，放进了孤块池
+	BlockDuplicate                     //已经存储过
+)
+
+func (s BlockStatus) String() string {
+	switch s {
+	case BlockMainChain:
+		return "main chain"
+	case BlockSideBranch:
+		return "side branch"
+	case BlockReorg:
+		return "reorganized"
+	case BlockOrphan:
+		return "orphan"
+	case BlockDuplicate:
+		return "duplicate"
+	}
+
+	return fmt.Sprintf("BlockStatus(%d)", int(s))
+}
+
+// ChainIndex 是从主链派生出来的索引，主链每连接或断开一个块都会通知它
+type ChainIndex interface {
+	ConnectBlock(b *block.Block, height int) error
+	DisconnectBlock(b *block.Block, height int) error
+}
+
+// ReorgEvent 描述一次链重组
+type ReorgEvent struct {
+	OldTip       []byte
+	NewTip       []byte
+	ForkPoint    []byte         //新旧两条链的最后一个公共块
+	Disconnected []*block.Block //从旧 tip 往回被断开的块
+	Connected    []*block.Block //从分叉点往前被连接的块
+}
+
+// 注册一个派生索引
+func (bc *Blockchain) AddIndex(index ChainIndex) {
+	bc.indexes = append(bc.indexes, index)
+}
+
+// 订阅链重组事件
+func (bc *Blockchain) OnReorg(fn func(ReorgEvent)) {
+	bc.reorgListeners = append(bc.reorgListeners, fn)
+}
+
+// 在指定的父块上挖一个新块并处理它，可以用来制造分叉
+func (bc *Blockchain) AddBlockOn(parent []byte, data string) (*block.Block, BlockStatus, error) {
+	newBlock, err := bc.newBlock(data, parent)
+	if err != nil {
+		return nil, 0, err
+	}
+	status, err := bc.ProcessBlock(newBlock)
+
+	return newBlock, status, err
+}
+
+// ProcessBlock 校验并存储一个块，必要时进行链重组，然后处理等待这个块的孤块
+func (bc *Blockchain) ProcessBlock(b *block.Block) (BlockStatus, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.processBlockAndOrphans(b)
+}
+
+// 只有 block 的父块仍然是 tip 时才处理它，否则返回 errTipMoved 且不存储这个块。
+// 处理时 tip 被别的实例推进、块只能留在侧链上时也返回 errTipMoved，调用者在新的 tip 上重新挖
+func (bc *Blockchain) processIfTip(b *block.Block) (BlockStatus, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if !bytes.Equal(b.PrevBlockHash, bc.tip) {
+		return 0, errTipMoved
+	}
+	status, err := bc.processBlockAndOrphans(b)
+	if err == nil && status == BlockSideBranch {
+		return status, errTipMoved
+	}
+
+	return status, err
+}
+
+// 调用者必须持有 bc.mu
+func (bc *Blockchain) processBlockAndOrphans(b *block.Block) (BlockStatus, error) {
+	status, err := bc.processBlock(b)
+	if err != nil || status == BlockOrphan || status == BlockDuplicate {
+		return status, err
+	}
+
+	//这个块到达后，以它为父块的孤块就可以处理了
+	queue := [][]byte{b.Hash}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, orphan := range bc.orphans.takeChildren(parent) {
+			orphanStatus, err := bc.processBlock(orphan)
+			if err != nil {
+				continue //无效的孤块直接丢弃
+			}
+			if orphanStatus == BlockReorg {
+				status = BlockReorg
+			}
+			queue = append(queue, orphan.Hash)
+		}
+	}
+
+	//主链变长以后，开启了裁剪模式的话顺便裁剪旧的区块体
+	_, err = bc.prune()
+	if err != nil {
+		return status, err
+	}
+
+	return status, nil
+}
+
+func (bc *Blockchain) processBlock(b *block.Block) (BlockStatus, error) {
+	_, err := bc.store.GetBlock(b.Hash)
+	if err == nil {
+		return BlockDuplicate, nil
+	}
+	if !errors.Is(err, store.ErrBlockNotFound) {
+		return 0, err
+	}
+
+	proof := bc.Proof(b)
+	if !proof.Validate() || !bytes.Equal(proof.Hash(), b.Hash) {
+		return 0, fmt.Errorf("%w: %w: proof of work does not match hash %x", block.ErrInvalid, pow.ErrInvalid, b.Hash)
+	}
+	if len(b.PrevBlockHash) == 0 {
+		return 0, fmt.Errorf("%w: %x", ErrUnknownGenesis, b.Hash)
+	}
+
+	_, err = bc.store.GetBlock(b.PrevBlockHash)
+	if errors.Is(err, store.ErrBlockNotFound) {
+		bc.orphans.add(b)
+		return BlockOrphan, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	parentHeight, err := bc.heightOf(b.PrevBlockHash)
+	if err != nil {
+		return 0, err
+	}
+	//先存储再推进 tip。tip 没推进成功时块留在存储里，它是一个有效的块，就和侧链上的块一样，不需要回滚
+	err = bc.store.PutBlock(b)
+	if err != nil {
+		return 0, err
+	}
+	height := parentHeight + 1
+	bc.heights[string(b.Hash)] = height
+
+	//另一个使用同一存储的实例抢先推进了 tip 时，advanceTip 已经读回了新的 tip，按新的 tip 重新判断
+	for {
+		status, err := bc.connectBlock(b, height)
+		if err == errTipMoved {
+			continue
+		}
+
+		return status, err
+	}
+}
+
+// 把一个已存储的块接到主链上：接在 tip 后面、留在侧链上或者重组过去。
+// 比较并交换 tip 失败时返回 errTipMoved，此时 tip 和索引都没有改动
+func (bc *Blockchain) connectBlock(b *block.Block, height int) (BlockStatus, error) {
+	tipHeight, err := bc.heightOf(bc.tip)
+	if err != nil {
+		return 0, err
+	}
+	if height <= tipHeight {
+		return BlockSideBranch, nil
+	}
+
+	if bytes.Equal(b.PrevBlockHash, bc.tip) {
+		err = bc.advanceTip(bc.tip, b.Hash)
+		if err != nil {
+			return 0, err
+		}
+		err = bc.connectIndexes(b, height)
+		if err != nil {
+			return 0, err
+		}
+
+		return BlockMainChain, nil
+	}
+
+	err = bc.reorganize(b.Hash)
+	if err != nil {
+		return 0, err
+	}
+
+	return BlockReorg, nil
+}
+
+// 把主链切换到以 newTip 结尾的分支上
+func (bc *Blockchain) reorganize(newTip []byte) error {
+	oldTip := bc.tip
+	event := ReorgEvent{OldTip: oldTip, NewTip: newTip}
+
+	//两边先走到同一高度，再一起往回走，直到遇到同一个块，就是分叉点
+	oldHash, newHash := oldTip, newTip
+	oldHeight, err := bc.heightOf(oldHash)
+	if err != nil {
+		return err
+	}
+	newHeight, err := bc.heightOf(newHash)
+	if err != nil {
+		return err
+	}
+	var connected []*block.Block
+	for !bytes.Equal(oldHash, newHash) {
+		if oldHeight >= newHeight {
+			b, err := bc.store.GetBlock(oldHash)
+			if err != nil {
+				return err
+			}
+			event.Disconnected = append(event.Disconnected, b)
+			oldHash, oldHeight = b.PrevBlockHash, oldHeight-1
+		} else {
+			b, err := bc.store.GetBlock(newHash)
+			if err != nil {
+				return err
+			}
+			connected = append(connected, b)
+			newHash, newHeight = b.PrevBlockHash, newHeight-1
+		}
+	}
+	event.ForkPoint = oldHash
+	forkHeight := oldHeight
+
+	//connected 是从新 tip 往回收集的，连接时要从分叉点往前
+	for i := len(connected) - 1; i >= 0; i-- {
+		event.Connected = append(event.Connected, connected[i])
+	}
+
+	err = bc.advanceTip(oldTip, newTip)
+	if err != nil {
+		return err
+	}
+
+	for i, b := range event.Disconnected {
+		height := forkHeight + len(event.Disconnected) - i
+		for _, index := range bc.indexes {
+			err := index.DisconnectBlock(b, height)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for i, b := range event.Connected {
+		err := bc.connectIndexes(b, forkHeight+1+i)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fn := range bc.reorgListeners {
+		fn(event)
+	}
+
+	return nil
+}
+
+// 用比较并交换的方式把存储中的 tip 从 old 推进到 new，存储中的 tip 已经不是 old 时返回 errTipMoved
+func (bc *Blockchain) advanceTip(old, new []byte) error {
+	swapped, err := bc.store.CompareAndSwapTip(old, new)
+	if err != nil {
+		return err
+	}
+	if !swapped {
+		//别的 Blockchain 实例改动了同一个存储，重新读取 tip 以便调用者重试
+		bc.tip, err = bc.store.GetTip()
+		if err != nil {
+			return err
+		}
+
+		return errTipMoved
+	}
+	bc.tip = new
+
+	return nil
+}
+
+func (bc *Blockchain) connectIndexes(b *block.Block, height int) error {
+	for _, index := range bc.indexes {
+		err := index.ConnectBlock(b, height)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 计算一个已存储块的高度（创世块为 0），算过的高度会缓存起来，因为一个块的高度永远不会变
+func (bc *Blockchain) heightOf(hash []byte) (int, error) {
+	var path [][]byte
+	seen := make(map[string]bool)
+	height := -1
+	for {
+		if h, ok := bc.heights[string(hash)]; ok {
+			height = h
+			break
+		}
+		if seen[string(hash)] {
+			return 0, fmt.Errorf("%w: cycle at block %x", ErrBrokenAncestors, hash)
+		}
+		seen[string(hash)] = true
+		b, err := bc.store.GetBlock(hash)
+		if errors.Is(err, store.ErrBlockNotFound) {
+			return 0, fmt.Errorf("%w: missing block %x", ErrBrokenAncestors, hash)
+		}
+		if err != nil {
+			return 0, err
+		}
+		path = append(path, hash)
+		if len(b.PrevBlockHash) == 0 {
+			break
+		}
+		hash = b.PrevBlockHash
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		height++
+		bc.heights[string(path[i])] = height
+	}
+
+	return height, nil
+}
+
+//------------------------------------------孤块池------------------------------------------
+
+// orphanPool 按父块哈希保存父块还没到达的块，只存在于内存中
+type orphanPool struct {
+	byParent map[string][]*block.Block
+	order    [][]byte //进入的顺序，用于淘汰最早的孤块
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{byParent: make(map[string][]*block.Block)}
+}
+
+func (p *orphanPool) add(b *block.Block) {
+	parent := hex.EncodeToString(b.PrevBlockHash)
+	for _, existing := range p.byParent[parent] {
+		if bytes.Equal(existing.Hash, b.Hash) {
+			return
+		}
+	}
+	if len(p.order) >= maxOrphans {
+		p.remove(p.order[0])
+	}
+	p.byParent[parent] = append(p.byParent[parent], b)
+	p.order = append(p.order, b.Hash)
+}
+
+func (p *orphanPool) remove(hash []byte) {
+	//一个哈希只会出现一次，找到以后立即停止，不能在修改了切片以后继续遍历它
+found:
+	for parent, blocks := range p.byParent {
+		for i, b := range blocks {
+			if bytes.Equal(b.Hash, hash) {
+				p.byParent[parent] = append(blocks[:i], blocks[i+1:]...)
+				if len(p.byParent[parent]) == 0 {
+					delete(p.byParent, parent)
+				}
+				break found
+			}
+		}
+	}
+	for i, h := range p.order {
+		if bytes.Equal(h, hash) {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// 取出并移除所有以 parent 为父块的孤块
+func (p *orphanPool) takeChildren(parent []byte) []*block.Block {
+	children := append([]*block.Block{}, p.byParent[hex.EncodeToString(parent)]...)
+	for _, child := range children {
+		p.remove(child.Hash)
+	}
+
+	return children
+}
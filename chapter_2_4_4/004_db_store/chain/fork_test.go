@@ -0,0 +1,200 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 记录主链高度 -> 哈希，用来检查重组时索引的回滚和重放顺序
+type recordingIndex struct {
+	byHeight map[int][]byte
+}
+
+func (r *recordingIndex) ConnectBlock(blk *block.Block, height int) error {
+	r.byHeight[height] = blk.Hash
+	return nil
+}
+
+func (r *recordingIndex) DisconnectBlock(blk *block.Block, height int) error {
+	if !bytes.Equal(r.byHeight[height], blk.Hash) {
+		return errors.New("disconnecting a block that is not connected at this height")
+	}
+	delete(r.byHeight, height)
+	return nil
+}
+
+func mustHeight(t *testing.T, bc *Blockchain) int {
+	t.Helper()
+	height, err := bc.Height()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return height
+}
+
+// 在主链的创世块后面挖 a1 a2，再从 a1 分出 b2 b3，侧链更长时发生重组，之后主链又被 a 分支追回来
+func TestForkAndReorg(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			bc := newTestChain(t, backend.newStore(t))
+			genesis := bc.tip
+			index := &recordingIndex{byHeight: map[int][]byte{0: genesis}}
+			bc.AddIndex(index)
+			var reorgs []ReorgEvent
+			bc.OnReorg(func(e ReorgEvent) { reorgs = append(reorgs, e) })
+
+			hashes := map[string][]byte{"genesis": genesis}
+			steps := []struct {
+				name, parent string
+				status       BlockStatus
+				tip          string //这一步之后的 tip
+				height       int
+				reorgs       int //到这一步为止发生的重组次数
+			}{
+				{"a1", "genesis", BlockMainChain, "a1", 1, 0},
+				{"a2", "a1", BlockMainChain, "a2", 2, 0},
+				{"b2", "a1", BlockSideBranch, "a2", 2, 0}, //高度相同时保留先到的链
+				{"b3", "b2", BlockReorg, "b3", 3, 1},
+				{"a3", "a2", BlockSideBranch, "b3", 3, 1},
+				{"a4", "a3", BlockReorg, "a4", 4, 2},
+				{"c1", "genesis", BlockSideBranch, "a4", 4, 2},
+			}
+
+			for _, step := range steps {
+				b, status, err := bc.AddBlockOn(hashes[step.parent], step.name)
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				hashes[step.name] = b.Hash
+				if status != step.status {
+					t.Errorf("%s: status = %v, want %v", step.name, status, step.status)
+				}
+				if !bytes.Equal(bc.tip, hashes[step.tip]) {
+					t.Errorf("%s: tip = %x, want %s", step.name, bc.tip, step.tip)
+				}
+				if height := mustHeight(t, bc); height != step.height {
+					t.Errorf("%s: height = %d, want %d", step.name, height, step.height)
+				}
+				if len(reorgs) != step.reorgs {
+					t.Errorf("%s: %d reorgs, want %d", step.name, len(reorgs), step.reorgs)
+				}
+			}
+
+			//最后一次重组从 b3 回到 a 分支：断开 b3 b2，连接 a2 a3 a4
+			last := reorgs[len(reorgs)-1]
+			if !bytes.Equal(last.ForkPoint, hashes["a1"]) || len(last.Disconnected) != 2 || len(last.Connected) != 3 {
+				t.Errorf("last reorg: fork point %x, %d disconnected, %d connected; want a1, 2, 3",
+					last.ForkPoint, len(last.Disconnected), len(last.Connected))
+			}
+
+			//索引跟着重组更新
+			for height, name := range []string{"genesis", "a1", "a2", "a3", "a4"} {
+				if !bytes.Equal(index.byHeight[height], hashes[name]) {
+					t.Errorf("index height %d: %x, want %s", height, index.byHeight[height], name)
+				}
+			}
+			if len(index.byHeight) != 5 {
+				t.Errorf("index has %d heights, want 5", len(index.byHeight))
+			}
+			for height, name := range []string{"genesis", "a1", "a2", "a3", "a4"} {
+				hash, err := bc.HashAtHeight(height)
+				if err != nil || !bytes.Equal(hash, hashes[name]) {
+					t.Errorf("HashAtHeight(%d) = %x, %v, want %s", height, hash, err, name)
+				}
+			}
+			if _, err := bc.HashAtHeight(5); err != store.ErrBlockNotFound {
+				t.Errorf("HashAtHeight(5) err = %v, want store.ErrBlockNotFound", err)
+			}
+		})
+	}
+}
+
+// 父块未知的块先进入孤块池，父块到达后一起接到链上
+func TestOrphanConnectsWhenParentArrives(t *testing.T) {
+	bc := newTestChain(t, store.NewMemoryStore())
+	one := mustNewBlock(t, bc, "one", bc.tip)
+	two := mustNewBlock(t, bc, "two", one.Hash)
+
+	steps := []struct {
+		blk    *block.Block
+		status BlockStatus
+		height int
+	}{
+		{two, BlockOrphan, 0},
+		{two, BlockOrphan, 0},
+		{one, BlockMainChain, 2}, //two 跟着接上
+		{two, BlockDuplicate, 2},
+	}
+
+	for i, step := range steps {
+		status, err := bc.ProcessBlock(step.blk)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if status != step.status {
+			t.Errorf("step %d: status = %v, want %v", i, status, step.status)
+		}
+		if height := mustHeight(t, bc); height != step.height {
+			t.Errorf("step %d: height = %d, want %d", i, height, step.height)
+		}
+	}
+	if !bytes.Equal(bc.tip, two.Hash) {
+		t.Errorf("tip = %x, want %x", bc.tip, two.Hash)
+	}
+}
+
+func TestProcessInvalidBlock(t *testing.T) {
+	bc := newTestChain(t, store.NewMemoryStore())
+
+	forged := mustNewBlock(t, bc, "forged", bc.tip)
+	forged.Data = []byte("changed after mining")
+	if _, err := bc.ProcessBlock(forged); !errors.Is(err, block.ErrInvalid) {
+		t.Errorf("tampered block: err = %v, want block.ErrInvalid", err)
+	}
+
+	other := mustNewBlock(t, bc, "another genesis", []byte{})
+	if _, err := bc.ProcessBlock(other); !errors.Is(err, ErrUnknownGenesis) {
+		t.Errorf("foreign genesis: err = %v, want ErrUnknownGenesis", err)
+	}
+}
+
+// 两个实例共用一个存储：落后的实例处理块时 tip 已经被另一个推进，公开的方法不能把 errTipMoved 返回给调用者
+func TestProcessBlockTipMoved(t *testing.T) {
+	s := store.NewMemoryStore()
+	ahead := newTestChain(t, s)
+	behind := newTestChain(t, s)
+	genesis := behind.Tip()
+	mustAddBlocks(t, ahead, "a1")
+
+	//同一高度上后到的块留在侧链上
+	b1 := mustNewBlock(t, behind, "b1", genesis)
+	status, err := behind.ProcessBlock(b1)
+	if err != nil || status != BlockSideBranch {
+		t.Fatalf("ProcessBlock(b1) = %v, %v; want side branch", status, err)
+	}
+	if !bytes.Equal(behind.Tip(), ahead.Tip()) {
+		t.Errorf("tip = %x, want the tip %x written by the other instance", behind.Tip(), ahead.Tip())
+	}
+
+	//AddBlock 在新的 tip 上重新挖
+	mustAddBlocks(t, ahead, "a2")
+	b, err := behind.AddBlock("b3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Hash, behind.Tip()) || mustHeight(t, behind) != 3 {
+		t.Errorf("AddBlock on a stale instance: tip %x at height %d, want %x at height 3", behind.Tip(), mustHeight(t, behind), b.Hash)
+	}
+	tip, err := s.GetTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tip, b.Hash) {
+		t.Errorf("stored tip = %x, want %x", tip, b.Hash)
+	}
+}
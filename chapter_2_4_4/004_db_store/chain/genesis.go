@@ -0,0 +1,202 @@
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/pow"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================创世块配置===========================================
+/**
+原来的创世块写死了内容 "Genesis Block1"，时间戳取的是创建时的当前时间，所以每个人新建的链都有不同的创世块哈希，无法比较。
+现在可以用一个 JSON 文件描述创世块，同一个文件在任何机器上挖出的创世块都完全相同：
+	{
+		"data": "Genesis Block1",
+		"timestamp": 1700000000,
+		"target_bits": 16,
+		"hash_algorithm": "sha256",
+		"chain_id": "team-testnet"
+	}
+1.data 和 timestamp 决定创世块的内容，timestamp 是 Unix 秒数，必须给出
+2.target_bits 和 hash_algorithm 是整条链的挖矿难度和哈希算法，记录在元数据中，以后打开这条链时使用它们
+3.chain_id 是链的标识，为空时和旧文件一样取创世块哈希的前 8 个字节
+省略的字段取默认值：data 为 "Genesis Block1"，target_bits 为打开链的配置中的难度，hash_algorithm 为 sha256。
+*/
+
+var (
+	ErrChainExists    = errors.New("chain already exists")
+	ErrInvalidGenesis = errors.New("invalid genesis configuration")
+)
+
+// Genesis 描述一条新链的创世块和链的参数
+type Genesis struct {
+	Data          string `json:"data"`
+	Timestamp     int64  `json:"timestamp"`
+	TargetBits    int    `json:"target_bits"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	ChainID       string `json:"chain_id"`
+}
+
+// 默认的创世块：内容固定，时间戳为当前时间
+func defaultGenesis(targetBits int) *Genesis {
+	return &Genesis{Data: genesisData, Timestamp: time.Now().Unix(), TargetBits: targetBits, HashAlgorithm: pow.DefaultHash}
+}
+
+// 读取创世块配置文件，省略的 target_bits 取 targetBits
+func LoadGenesis(path string, targetBits int) (*Genesis, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g := &Genesis{Data: genesisData, TargetBits: targetBits, HashAlgorithm: pow.DefaultHash}
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(g)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", path, ErrInvalidGenesis, err)
+	}
+	if g.Timestamp <= 0 {
+		return nil, fmt.Errorf("%s: %w: timestamp is required so that everyone derives the same genesis block", path, ErrInvalidGenesis)
+	}
+	err = g.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return g, nil
+}
+
+func (g *Genesis) validate() error {
+	if err := pow.CheckTargetBits(g.TargetBits); err != nil {
+		return fmt.Errorf("%w: target_bits: %w", ErrInvalidGenesis, err)
+	}
+	if !slices.Contains(pow.Hashes, g.HashAlgorithm) {
+		return fmt.Errorf("%w: hash_algorithm %q is not one of %v", ErrInvalidGenesis, g.HashAlgorithm, pow.Hashes)
+	}
+
+	return nil
+}
+
+// 新建 cfg 指定的链，链文件必须还不存在；cfg.Genesis 为 nil 时使用默认的创世块
+func Create(cfg Config) (*Blockchain, error) {
+	path, err := store.ChainPath(cfg.DataDir, cfg.Chain)
+	if err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(path)
+	if err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrChainExists, path)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return Open(cfg)
+}
+
+// 按 g 挖出创世块，把它和链的参数写入空的存储，返回是否由自己写入（同时有别人创建了链时为 false）
+func (bc *Blockchain) createGenesis(g *Genesis) (bool, error) {
+	err := g.validate()
+	if err != nil {
+		return false, err
+	}
+	err = bc.setParams(g.TargetBits, g.HashAlgorithm)
+	if err != nil {
+		return false, err
+	}
+
+	genesis := &block.Block{Timestamp: g.Timestamp, Data: []byte(g.Data), PrevBlockHash: []byte{}, Hash: []byte{}}
+	err = bc.Proof(genesis).Mine(bc.log)
+	if err != nil {
+		return false, err
+	}
+
+	err = bc.store.PutBlock(genesis) //将创世区块与该块的哈希（作为键值）一起存入
+	if err != nil {
+		return false, err
+	}
+	swapped, err := bc.store.CompareAndSwapTip(nil, genesis.Hash) //此时创世块作为最后一个块存在
+	if err != nil || !swapped {
+		return false, err
+	}
+	bc.tip = genesis.Hash //指向创世区块
+
+	meta := map[string][]byte{
+		store.GenesisHashKey:   genesis.Hash,
+		store.TargetBitsKey:    block.IntToHex(int64(g.TargetBits)),
+		store.HashAlgorithmKey: []byte(g.HashAlgorithm),
+	}
+	if g.ChainID != "" {
+		meta[store.ChainIDKey] = []byte(g.ChainID)
+	}
+	for key, value := range meta {
+		err = bc.store.PutMeta(key, value)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, bc.connectIndexes(genesis, 0)
+}
+
+// 已有的链使用元数据中记录的难度和哈希算法，旧文件没有记录时使用 defaultTargetBits 和 SHA-256
+func (bc *Blockchain) loadParams(defaultTargetBits int) error {
+	targetBits, err := bc.metaInt(store.TargetBitsKey, defaultTargetBits)
+	if err != nil {
+		return err
+	}
+	hashName, err := bc.store.GetMeta(store.HashAlgorithmKey)
+	if err != nil {
+		return err
+	}
+	if hashName == nil {
+		hashName = []byte(pow.DefaultHash)
+	}
+
+	return bc.setParams(targetBits, string(hashName))
+}
+
+func (bc *Blockchain) setParams(targetBits int, hashName string) error {
+	err := pow.CheckTargetBits(targetBits)
+	if err != nil {
+		return err
+	}
+	hash, err := pow.LookupHash(hashName)
+	if err != nil {
+		return err
+	}
+	bc.targetBits = targetBits
+	bc.hashName = hashName
+	bc.hash = hash
+
+	return nil
+}
+
+// 区块 b 在这条链上的工作量证明，使用链的难度、哈希算法和 nonce 上限
+func (bc *Blockchain) Proof(b *block.Block) *pow.ProofOfWork {
+	proof := pow.NewWithHash(b, bc.targetBits, bc.hash)
+	proof.SetMaxNonce(bc.maxNonce)
+
+	return proof
+}
+
+// 挖矿使用的哈希算法
+func (bc *Blockchain) HashAlgorithm() string {
+	return bc.hashName
+}
+
+// 元数据中是否记录了链的难度，旧文件没有记录，打开时使用配置中的难度
+func (bc *Blockchain) TargetBitsRecorded() (bool, error) {
+	targetBits, err := bc.store.GetMeta(store.TargetBitsKey)
+
+	return targetBits != nil, err
+}
@@ -0,0 +1,122 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"test/blockchain-project/004_db_store/pow"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 写一个临时的创世块配置文件，返回它的路径
+func writeGenesis(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadGenesis(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Genesis
+		err     error
+	}{
+		{"full", `{"data": "hello", "timestamp": 1700000000, "target_bits": 6, "hash_algorithm": "sha3-256", "chain_id": "team"}`,
+			Genesis{Data: "hello", Timestamp: 1700000000, TargetBits: 6, HashAlgorithm: "sha3-256", ChainID: "team"}, nil},
+		{"defaults", `{"timestamp": 1700000000}`,
+			Genesis{Data: genesisData, Timestamp: 1700000000, TargetBits: testTargetBits, HashAlgorithm: pow.DefaultHash}, nil},
+		{"no timestamp", `{"data": "hello"}`, Genesis{}, ErrInvalidGenesis},
+		{"unknown field", `{"timestamp": 1700000000, "difficulty": 6}`, Genesis{}, ErrInvalidGenesis},
+		{"not json", `timestamp = 1700000000`, Genesis{}, ErrInvalidGenesis},
+		{"zero target bits", `{"timestamp": 1700000000, "target_bits": 0}`, Genesis{}, ErrInvalidGenesis},
+		{"too many target bits", `{"timestamp": 1700000000, "target_bits": 256}`, Genesis{}, ErrInvalidGenesis},
+		{"unknown hash", `{"timestamp": 1700000000, "hash_algorithm": "md5"}`, Genesis{}, ErrInvalidGenesis},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := LoadGenesis(writeGenesis(t, tt.content), testTargetBits)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("LoadGenesis error = %v, want %v", err, tt.err)
+			}
+			if err == nil && *g != tt.want {
+				t.Errorf("LoadGenesis = %+v, want %+v", *g, tt.want)
+			}
+		})
+	}
+
+	_, err := LoadGenesis(filepath.Join(t.TempDir(), "missing.json"), testTargetBits)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadGenesis(missing) error = %v, want os.ErrNotExist", err)
+	}
+}
+
+// 同一个创世块配置在不同的数据目录中挖出相同的创世块，链的参数记录在元数据中，以后打开时使用记录的参数
+func TestCreateFromGenesis(t *testing.T) {
+	genesis := &Genesis{Data: "team genesis", Timestamp: 1700000000, TargetBits: 6, HashAlgorithm: "sha256d", ChainID: "team"}
+
+	var genesisHashes [][]byte
+	for i := 0; i < 2; i++ {
+		cfg := testConfig(t)
+		cfg.Genesis = genesis
+		bc, err := Create(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		genesisHashes = append(genesisHashes, bc.Tip())
+		mustAddBlocks(t, bc, "one")
+		bc.Close()
+
+		//重新打开时配置中的难度不同，使用链记录的难度和哈希算法
+		cfg.Genesis = nil
+		cfg.TargetBits = 10
+		bc, err = Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chainID, err := bc.ChainID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bc.TargetBits() != genesis.TargetBits || bc.HashAlgorithm() != genesis.HashAlgorithm || chainID != genesis.ChainID {
+			t.Errorf("reopened chain: %d target bits, %s, chain id %q; want %d, %s, %q",
+				bc.TargetBits(), bc.HashAlgorithm(), chainID, genesis.TargetBits, genesis.HashAlgorithm, genesis.ChainID)
+		}
+		report, err := bc.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.OK() || report.Blocks != 2 {
+			t.Errorf("verify: %d blocks, problems %v", report.Blocks, report.Problems)
+		}
+
+		//链已经存在时不能再创建
+		_, err = Create(cfg)
+		if !errors.Is(err, ErrChainExists) {
+			t.Errorf("Create on an existing chain: err = %v, want ErrChainExists", err)
+		}
+		bc.Close()
+	}
+
+	if !bytes.Equal(genesisHashes[0], genesisHashes[1]) {
+		t.Errorf("genesis hashes %x and %x differ for the same genesis file", genesisHashes[0], genesisHashes[1])
+	}
+}
+
+func TestCreateInvalidGenesis(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Genesis = &Genesis{Timestamp: 1700000000, TargetBits: testTargetBits, HashAlgorithm: "md5"}
+	_, err := New(store.NewMemoryStore(), cfg)
+	if !errors.Is(err, ErrInvalidGenesis) {
+		t.Errorf("New with hash md5: err = %v, want ErrInvalidGenesis", err)
+	}
+}
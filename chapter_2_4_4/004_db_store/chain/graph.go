@@ -0,0 +1,139 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+//==========================================区块图===========================================
+/**
+printchain 只能看到主链，分叉和孤块只能从 verifychain 的数字里猜。Graph 把存储中的每一个块都作为图中的一个节点：
+1.从 tip（键 "l"）沿 PrevBlockHash 走到的块是主链
+2.能从创世块到达、但不在主链上的块是侧链
+3.到不了创世块的块是孤块，PrevBlockHash 指向的块不存在时，额外加一个“缺失”节点
+4.无法解码的条目也是一个节点，它没有连线
+每个节点带有高度（到不了创世块时为 -1）和校验结果（checkBlock 给出的原因），连线就是每个块的 PrevBlockHash。
+输出成什么格式由调用者决定，见 cli 中的 graph 命令。
+*/
+
+// NodeKind 是区块在图中的类别
+type NodeKind int
+
+const (
+	NodeMain        NodeKind = iota //主链上的块
+	NodeSide                        //侧链上的块
+	NodeOrphan                      //到不了创世块的块
+	NodeUndecodable                 //无法解码的条目
+	NodeMissing                     //被引用但不存在的块
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case NodeMain:
+		return "main"
+	case NodeSide:
+		return "side"
+	case NodeOrphan:
+		return "orphan"
+	case NodeUndecodable:
+		return "undecodable"
+	case NodeMissing:
+		return "missing"
+	}
+
+	return "unknown"
+}
+
+// GraphNode 是图中的一个节点
+type GraphNode struct {
+	Key     []byte       //存储中的键，缺失的块为被引用的哈希
+	Block   *block.Block //无法解码和缺失的块为 nil
+	Kind    NodeKind
+	Height  int    //到不了创世块时为 -1
+	Tip     bool   //是否是 tip
+	HasBody bool   //区块体是否可读
+	Problem string //块无效或无法解码的原因，有效时为空
+}
+
+// 存储中全部区块组成的图，节点按高度排序，高度未知的排在最后
+func (bc *Blockchain) Graph() ([]GraphNode, error) {
+	var nodes []GraphNode
+	blocks := make(map[string]*block.Block)
+	err := bc.scanBlocks(func(key []byte, b *block.Block, err error) error {
+		if err != nil {
+			nodes = append(nodes, GraphNode{Key: key, Kind: NodeUndecodable, Height: -1, Problem: scanReason(err)})
+			return nil
+		}
+		blocks[string(key)] = b
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[string][]string)
+	for key, b := range blocks {
+		children[string(b.PrevBlockHash)] = append(children[string(b.PrevBlockHash)], key)
+	}
+	heights := make(map[string]int)
+	genesis, err := bc.repairGenesis(blocks, children[""])
+	if err != nil && !errors.Is(err, ErrNoGenesis) {
+		return nil, err
+	}
+	if genesis != nil {
+		heights = heightsFrom(string(genesis), children)
+	}
+
+	tip, err := bc.store.GetTip()
+	if err != nil {
+		return nil, err
+	}
+	mainChain := make(map[string]bool)
+	for key := string(tip); blocks[key] != nil && !mainChain[key]; key = string(blocks[key].PrevBlockHash) {
+		mainChain[key] = true
+	}
+
+	missing := make(map[string]bool)
+	for key, b := range blocks {
+		node := GraphNode{Key: []byte(key), Block: b, Kind: NodeOrphan, Height: -1, Tip: key == string(tip)}
+		if height, ok := heights[key]; ok {
+			node.Kind = NodeSide
+			node.Height = height
+		}
+		if mainChain[key] {
+			node.Kind = NodeMain
+		}
+		node.HasBody, err = bc.HasBody(node.Key)
+		if err != nil {
+			return nil, err
+		}
+		node.Problem, err = bc.checkBlock(node.Key, b)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		prev := string(b.PrevBlockHash)
+		if prev != "" && blocks[prev] == nil && !missing[prev] {
+			missing[prev] = true
+			nodes = append(nodes, GraphNode{Key: []byte(prev), Kind: NodeMissing, Height: -1, Problem: "referenced but not stored"})
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		hi, hj := nodes[i].Height, nodes[j].Height
+		if (hi < 0) != (hj < 0) {
+			return hj < 0
+		}
+		if hi != hj {
+			return hi < hj
+		}
+		return bytes.Compare(nodes[i].Key, nodes[j].Key) < 0
+	})
+
+	return nodes, nil
+}
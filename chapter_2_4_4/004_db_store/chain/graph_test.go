@@ -0,0 +1,133 @@
+package chain
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 主链 genesis a1 a2，从 a1 分出被篡改的 b2；再直接写入 bolt 文件：一个父块不存在的孤块、一个无法解码的条目、
+// 一个存在别的键下的 a1 副本。Graph 要把每一个都作为节点，并给出类别、高度和问题
+func TestGraph(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	s, err := store.NewBoltStore(path, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := newTestChain(t, s)
+	hashes := map[string][]byte{"genesis": bc.Tip()}
+	for _, step := range []struct{ name, parent string }{{"a1", "genesis"}, {"a2", "a1"}, {"b2", "a1"}} {
+		b, _, err := bc.AddBlockOn(hashes[step.parent], step.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[step.name] = b.Hash
+	}
+	a1, err := s.GetBlock(hashes["a1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan := &block.Block{Timestamp: 1700000000, Data: []byte("orphan"), PrevBlockHash: bytes.Repeat([]byte{0xee}, 32)}
+	if err := bc.Proof(orphan).Mine(nil); err != nil {
+		t.Fatal(err)
+	}
+	hashes["orphan"] = orphan.Hash
+	hashes["missing"] = orphan.PrevBlockHash
+	hashes["undecodable"] = bytes.Repeat([]byte{0xdd}, 32)
+	hashes["copy"] = bytes.Repeat([]byte{0xcc}, 32)
+	bc.Close()
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("blocks"))
+		tampered, err := block.Deserialize(b.Get(hashes["b2"]))
+		if err != nil {
+			return err
+		}
+		tampered.Data = []byte("forged")
+		entries := map[string]*block.Block{"b2": tampered, "orphan": orphan, "copy": a1}
+		for name, blk := range entries {
+			encoded, err := blk.Serialize()
+			if err != nil {
+				return err
+			}
+			err = b.Put(hashes[name], encoded)
+			if err != nil {
+				return err
+			}
+		}
+		return b.Put(hashes["undecodable"], []byte("not a gob stream"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = store.NewBoltStore(path, store.DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	bc = newTestChain(t, s)
+	nodes, err := bc.Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name    string
+		kind    NodeKind
+		height  int
+		tip     bool
+		problem string //问题描述中应该出现的内容，"" 表示没有问题
+	}{
+		{"genesis", NodeMain, 0, false, ""},
+		{"a1", NodeMain, 1, false, ""},
+		{"copy", NodeSide, 1, false, "stored under this key"},
+		{"a2", NodeMain, 2, true, ""},
+		{"b2", NodeSide, 2, false, "proof of work is invalid"},
+		{"orphan", NodeOrphan, -1, false, ""},
+		{"missing", NodeMissing, -1, false, "referenced but not stored"},
+		{"undecodable", NodeUndecodable, -1, false, "corrupt"},
+	}
+	byKey := make(map[string]GraphNode)
+	for _, n := range nodes {
+		byKey[string(n.Key)] = n
+	}
+	if len(nodes) != len(want) {
+		t.Errorf("Graph returned %d nodes, want %d", len(nodes), len(want))
+	}
+	for _, w := range want {
+		n, ok := byKey[string(hashes[w.name])]
+		if !ok {
+			t.Errorf("%s: no node", w.name)
+			continue
+		}
+		if n.Kind != w.kind || n.Height != w.height || n.Tip != w.tip {
+			t.Errorf("%s: kind %v, height %d, tip %v; want %v, %d, %v", w.name, n.Kind, n.Height, n.Tip, w.kind, w.height, w.tip)
+		}
+		if (w.problem == "") != (n.Problem == "") || !strings.Contains(n.Problem, w.problem) {
+			t.Errorf("%s: problem %q, want %q", w.name, n.Problem, w.problem)
+		}
+		if (n.Block != nil) != (w.kind != NodeMissing && w.kind != NodeUndecodable) {
+			t.Errorf("%s: block %v", w.name, n.Block)
+		}
+	}
+
+	//节点按高度排序，高度未知的排在最后
+	for i := 1; i < len(nodes); i++ {
+		prev, cur := nodes[i-1].Height, nodes[i].Height
+		if cur >= 0 && (prev < 0 || prev > cur) {
+			t.Errorf("node %d at height %d follows height %d", i, cur, prev)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package chain
+
+import (
+	"encoding/binary"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================高度索引===========================================
+/**
+区块本身不记录高度，按高度找块只能从 tip 一路往回走。
+heights 索引保存主链上 高度 -> 区块哈希 的对应关系，键用 block.IntToHex 编码成 8 字节大端序（见 store.HeightKey），
+这样 bolt 中的键顺序就是高度顺序。它是一个 ChainIndex，主链连接或断开区块时自动更新，重组时也会正确回滚。
+*/
+
+// heightIndex 维护主链的高度索引
+type heightIndex struct {
+	store store.BlockStore
+}
+
+func (idx heightIndex) ConnectBlock(b *block.Block, height int) error {
+	return idx.store.PutIndex(store.HeightsIndex, store.HeightKey(height), b.Hash)
+}
+
+func (idx heightIndex) DisconnectBlock(b *block.Block, height int) error {
+	return idx.store.DeleteIndex(store.HeightsIndex, store.HeightKey(height))
+}
+
+// 主链上指定高度的区块哈希，高度超出主链范围时返回 store.ErrBlockNotFound
+func (bc *Blockchain) HashAtHeight(height int) ([]byte, error) {
+	hash, err := bc.store.GetIndex(store.HeightsIndex, store.HeightKey(height))
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		return nil, store.ErrBlockNotFound
+	}
+
+	return hash, nil
+}
+
+// 主链 tip 的高度，创世块为 0
+func (bc *Blockchain) Height() (int, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.heightOf(bc.tip)
+}
+
+// 按高度从低到高遍历主链上的区块哈希，只读取高度索引，不读取区块
+func (bc *Blockchain) ScanMainChain(fn func(height int, hash []byte) error) error {
+	return bc.store.ScanIndex(store.HeightsIndex, nil, func(key, value []byte) error {
+		return fn(int(binary.BigEndian.Uint64(key)), value)
+	})
+}
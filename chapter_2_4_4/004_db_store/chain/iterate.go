@@ -0,0 +1,169 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================正向与区间迭代===========================================
+/**
+BlockchainIterator 只能从 tip 往回走，并且要靠 len(block.PrevBlockHash) == 0 判断什么时候停下来。
+有了高度索引以后，可以按高度直接找到主链上的任意一个块，于是提供 Go 1.23 的 range-over-func 风格的迭代：
+	for block, err := range bc.Blocks(GenesisRef, TipRef) { ... }
+1.from 和 to 可以是高度（AtHeight）或哈希（AtHash），也可以是创世块（GenesisRef）和 tip（TipRef）
+2.from 比 to 低时从前往后走，否则从后往前走，两端都包含在内
+3.Ancestors 从任意一个块（包括侧链上的块）开始往回走到创世块
+出错时把错误交给循环体，而不是 panic；循环体 break 以后迭代立即停止。
+*/
+
+var (
+	ErrNotOnMainChain = errors.New("block is not on the main chain")
+	ErrChainChanged   = errors.New("chain was reorganized during iteration")
+)
+
+// BlockRef 表示主链上的一个位置
+type BlockRef struct {
+	height int
+	hash   []byte
+	tip    bool
+}
+
+// 主链上指定高度的块
+func AtHeight(height int) BlockRef {
+	return BlockRef{height: height}
+}
+
+// 指定哈希的块，它必须在主链上
+func AtHash(hash []byte) BlockRef {
+	return BlockRef{hash: hash}
+}
+
+var (
+	GenesisRef = AtHeight(0)
+	TipRef     = BlockRef{tip: true}
+)
+
+func (r BlockRef) String() string {
+	switch {
+	case r.tip:
+		return "tip"
+	case r.hash != nil:
+		return fmt.Sprintf("block %x", r.hash)
+	}
+
+	return fmt.Sprintf("height %d", r.height)
+}
+
+// 把 BlockRef 换算成主链上的高度
+func (bc *Blockchain) resolve(ref BlockRef, tipHeight int) (int, error) {
+	if ref.tip {
+		return tipHeight, nil
+	}
+	if ref.hash == nil {
+		if ref.height < 0 || ref.height > tipHeight {
+			return 0, fmt.Errorf("%w: height %d is outside the chain (tip height %d)", store.ErrBlockNotFound, ref.height, tipHeight)
+		}
+		return ref.height, nil
+	}
+
+	bc.mu.Lock()
+	height, err := bc.heightOf(ref.hash)
+	bc.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	onMain, err := bc.HashAtHeight(height)
+	if err != nil && !errors.Is(err, store.ErrBlockNotFound) {
+		return 0, err
+	}
+	if !bytes.Equal(onMain, ref.hash) {
+		return 0, fmt.Errorf("%w: %x", ErrNotOnMainChain, ref.hash)
+	}
+
+	return height, nil
+}
+
+// 按高度顺序遍历主链上 from 到 to 之间（包含两端）的块
+func (bc *Blockchain) Blocks(from, to BlockRef) iter.Seq2[*block.Block, error] {
+	return func(yield func(*block.Block, error) bool) {
+		tipHeight, err := bc.Height()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		start, err := bc.resolve(from, tipHeight)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		end, err := bc.resolve(to, tipHeight)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		step := 1
+		if start > end {
+			step = -1
+		}
+		var prev *block.Block
+		for height := start; ; height += step {
+			hash, err := bc.HashAtHeight(height)
+			if err != nil {
+				yield(nil, fmt.Errorf("height %d: %w", height, err))
+				return
+			}
+			b, err := bc.store.GetBlock(hash)
+			if err != nil {
+				yield(nil, fmt.Errorf("height %d: %w", height, &block.Error{Hash: hash, Err: err}))
+				return
+			}
+
+			//相邻两个块必须首尾相接，否则说明迭代过程中主链发生了重组
+			if prev != nil {
+				linked := bytes.Equal(b.PrevBlockHash, prev.Hash)
+				if step < 0 {
+					linked = bytes.Equal(prev.PrevBlockHash, b.Hash)
+				}
+				if !linked {
+					yield(nil, fmt.Errorf("%w: at height %d", ErrChainChanged, height))
+					return
+				}
+			}
+
+			if !yield(b, nil) || height == end {
+				return
+			}
+			prev = b
+		}
+	}
+}
+
+// 从任意一个已存储的块开始，沿 PrevBlockHash 往回走到创世块
+func (bc *Blockchain) Ancestors(from []byte) iter.Seq2[*block.Block, error] {
+	return func(yield func(*block.Block, error) bool) {
+		seen := make(map[string]bool)
+		for hash := from; len(hash) != 0; {
+			if seen[string(hash)] {
+				yield(nil, fmt.Errorf("%w: cycle at block %x", ErrBrokenAncestors, hash))
+				return
+			}
+			seen[string(hash)] = true
+
+			b, err := bc.store.GetBlock(hash)
+			if err != nil {
+				yield(nil, &block.Error{Hash: hash, Err: err})
+				return
+			}
+			if !yield(b, nil) {
+				return
+			}
+			hash = b.PrevBlockHash
+		}
+	}
+}
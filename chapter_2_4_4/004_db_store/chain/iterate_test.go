@@ -0,0 +1,149 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 主链：创世块 + b1 b2 b3 b4，另外从 b1 分出一个侧链块 side2
+func newIterateChain(t *testing.T, s store.BlockStore) (*Blockchain, map[string][]byte) {
+	t.Helper()
+	bc := newTestChain(t, s)
+	hashes := map[string][]byte{"genesis": bc.Tip()}
+	for i := 1; i <= 4; i++ {
+		name := fmt.Sprintf("b%d", i)
+		mustAddBlocks(t, bc, name)
+		hashes[name] = bc.Tip()
+	}
+	side, _, err := bc.AddBlockOn(hashes["b1"], "side2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes["side2"] = side.Hash
+
+	return bc, hashes
+}
+
+// 收集迭代出的块的数据，遇到错误时停止并返回它
+func collect(seq func(yield func(*block.Block, error) bool)) ([]string, error) {
+	var data []string
+	for blk, err := range seq {
+		if err != nil {
+			return data, err
+		}
+		data = append(data, string(blk.Data))
+	}
+
+	return data, nil
+}
+
+func TestBlocks(t *testing.T) {
+	genesis := string(genesisData)
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			bc, hashes := newIterateChain(t, backend.newStore(t))
+			tests := []struct {
+				name     string
+				from, to BlockRef
+				want     []string
+				err      error
+			}{
+				{"forward", GenesisRef, TipRef, []string{genesis, "b1", "b2", "b3", "b4"}, nil},
+				{"backward", TipRef, GenesisRef, []string{"b4", "b3", "b2", "b1", genesis}, nil},
+				{"heights", AtHeight(1), AtHeight(3), []string{"b1", "b2", "b3"}, nil},
+				{"hash to tip", AtHash(hashes["b2"]), TipRef, []string{"b2", "b3", "b4"}, nil},
+				{"single block", AtHeight(2), AtHash(hashes["b2"]), []string{"b2"}, nil},
+				{"height past tip", GenesisRef, AtHeight(5), nil, store.ErrBlockNotFound},
+				{"negative height", AtHeight(-1), TipRef, nil, store.ErrBlockNotFound},
+				{"side branch", AtHash(hashes["side2"]), TipRef, nil, ErrNotOnMainChain},
+				{"unknown hash", AtHash([]byte("nowhere")), TipRef, nil, ErrBrokenAncestors},
+			}
+
+			for _, tt := range tests {
+				data, err := collect(bc.Blocks(tt.from, tt.to))
+				if !errors.Is(err, tt.err) {
+					t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+				}
+				if !reflect.DeepEqual(data, tt.want) {
+					t.Errorf("%s: blocks = %q, want %q", tt.name, data, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// 循环体 break 以后迭代立即停止，不再读取后面的块
+func TestBlocksBreak(t *testing.T) {
+	bc, _ := newIterateChain(t, store.NewMemoryStore())
+	count := 0
+	for _, err := range bc.Blocks(GenesisRef, TipRef) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Errorf("loop ran %d times, want 2", count)
+	}
+}
+
+// 迭代过程中主链被重组时报告 ErrChainChanged，而不是把两条链拼在一起
+func TestBlocksChainChanged(t *testing.T) {
+	bc, hashes := newIterateChain(t, store.NewMemoryStore())
+
+	var data []string
+	var iterErr error
+	for blk, err := range bc.Blocks(GenesisRef, TipRef) {
+		if err != nil {
+			iterErr = err
+			break
+		}
+		data = append(data, string(blk.Data))
+		if len(data) == 2 {
+			//从创世块分出一条更长的链
+			parent := hashes["genesis"]
+			for i := 1; i <= 5; i++ {
+				b, _, err := bc.AddBlockOn(parent, fmt.Sprintf("fork%d", i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				parent = b.Hash
+			}
+		}
+	}
+	if !errors.Is(iterErr, ErrChainChanged) {
+		t.Errorf("err = %v after %q, want ErrChainChanged", iterErr, data)
+	}
+}
+
+func TestAncestors(t *testing.T) {
+	bc, hashes := newIterateChain(t, store.NewMemoryStore())
+	genesis := string(genesisData)
+
+	data, err := collect(bc.Ancestors(hashes["side2"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"side2", "b1", genesis}; !reflect.DeepEqual(data, want) {
+		t.Errorf("Ancestors(side2) = %q, want %q", data, want)
+	}
+
+	//父块不存在时，先给出已经走过的块，再给出错误
+	orphan := mustNewBlock(t, bc, "orphan", []byte("nowhere"))
+	if err := bc.store.PutBlock(orphan); err != nil {
+		t.Fatal(err)
+	}
+	data, err = collect(bc.Ancestors(orphan.Hash))
+	if !errors.Is(err, store.ErrBlockNotFound) || !reflect.DeepEqual(data, []string{"orphan"}) {
+		t.Errorf("Ancestors(orphan) = %q, %v, want [orphan] and store.ErrBlockNotFound", data, err)
+	}
+}
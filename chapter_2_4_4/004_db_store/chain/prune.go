@@ -0,0 +1,128 @@
+package chain
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+//==========================================区块体裁剪===========================================
+/**
+长期运行的节点，bolt 文件会随着每一个块的 Data 不断变大。开启裁剪模式后：
+1.所有区块的区块头（Timestamp、PrevBlockHash、Hash、Nonce）都会保留，链接关系和 tip 不受影响
+2.比 tip 低 depth 个块以上的主链区块，它们的 Data 会被删除，哈希记录到 pruned bucket 中
+3.元数据中记录裁剪深度（prunedepth）和已经裁剪到的高度（prunedheight）
+创世块永远不会被裁剪，它用来确认链的身份。
+区块体被删掉以后就无法重新计算 PoW 哈希了，这时只能检查区块头里的 Hash 是否满足难度目标。
+*/
+
+const (
+	pruneDepthKey   = "prunedepth"
+	prunedHeightKey = "prunedheight"
+	//至少保留这么多个块的区块体，重组时需要把断开的块重新交给派生索引
+	minPruneDepth = 6
+)
+
+// 设置裁剪深度并立即裁剪一次，depth 为 0 表示关闭裁剪模式（已经删除的区块体无法恢复）
+func (bc *Blockchain) SetPruneDepth(depth int) (int, error) {
+	if depth != 0 && depth < minPruneDepth {
+		return 0, fmt.Errorf("prune depth must be 0 (disabled) or at least %d, got %d", minPruneDepth, depth)
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	err := bc.store.PutMeta(pruneDepthKey, block.IntToHex(int64(depth)))
+	if err != nil {
+		return 0, err
+	}
+	bc.pruneDepth = depth
+
+	return bc.prune()
+}
+
+// 当前的裁剪深度，0 表示没有开启裁剪模式
+func (bc *Blockchain) PruneDepth() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.pruneDepth
+}
+
+// 已经裁剪到的高度，从未裁剪过时返回 -1
+func (bc *Blockchain) PrunedHeight() (int, error) {
+	return bc.metaInt(prunedHeightKey, -1)
+}
+
+// 区块体是否已经被裁剪
+func (bc *Blockchain) IsPruned(hash []byte) (bool, error) {
+	return bc.store.IsPruned(hash)
+}
+
+// 按照裁剪深度删除旧区块的区块体，返回本次裁剪的块数
+func (bc *Blockchain) Prune() (int, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.prune()
+}
+
+// 调用者必须持有 bc.mu
+func (bc *Blockchain) prune() (int, error) {
+	if bc.pruneDepth == 0 {
+		return 0, nil
+	}
+
+	tipHeight, err := bc.heightOf(bc.tip)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := tipHeight - bc.pruneDepth
+	prunedHeight, err := bc.PrunedHeight()
+	if err != nil {
+		return 0, err
+	}
+	if cutoff <= prunedHeight || cutoff < 1 {
+		return 0, nil
+	}
+
+	//从 tip 往回走到上次裁剪的位置，沿途把低于 cutoff 的区块体删掉
+	count := 0
+	hash := bc.tip
+	for height := tipHeight; height > prunedHeight && height > 0; height-- {
+		b, err := bc.store.GetBlock(hash)
+		if err != nil {
+			return count, err
+		}
+		if height <= cutoff {
+			pruned, err := bc.store.IsPruned(hash)
+			if err != nil {
+				return count, err
+			}
+			if !pruned {
+				err = bc.store.PruneBlock(hash)
+				if err != nil {
+					return count, err
+				}
+				count++
+			}
+		}
+		hash = b.PrevBlockHash
+	}
+
+	return count, bc.store.PutMeta(prunedHeightKey, block.IntToHex(int64(cutoff)))
+}
+
+// 读取一个用 IntToHex 编码的整数元数据
+func (bc *Blockchain) metaInt(key string, def int) (int, error) {
+	value, err := bc.store.GetMeta(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) != 8 {
+		return def, nil
+	}
+
+	return int(int64(binary.BigEndian.Uint64(value))), nil
+}
@@ -0,0 +1,72 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			bc := newTestChain(t, backend.newStore(t))
+			for i := 1; i <= 10; i++ {
+				mustAddBlocks(t, bc, fmt.Sprintf("block %d", i))
+			}
+
+			if _, err := bc.SetPruneDepth(minPruneDepth - 1); err == nil {
+				t.Fatalf("SetPruneDepth(%d) succeeded, want an error", minPruneDepth-1)
+			}
+
+			//tip 高度 10，深度 6：高度 1 到 4 的区块体被删除
+			steps := []struct {
+				add          int //这一步先追加的块数
+				pruned       int //这一步 Prune 裁剪的块数
+				prunedHeight int
+			}{
+				{0, 4, 4},
+				{0, 0, 4}, //重复裁剪不会再删除
+				{2, 0, 6}, //新块接到主链上时已经顺便裁剪了
+			}
+			for i, step := range steps {
+				for j := 0; j < step.add; j++ {
+					mustAddBlocks(t, bc, "more")
+				}
+				var n int
+				var err error
+				if i == 0 {
+					n, err = bc.SetPruneDepth(minPruneDepth)
+				} else {
+					n, err = bc.Prune()
+				}
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if n != step.pruned {
+					t.Errorf("step %d: pruned %d blocks, want %d", i, n, step.pruned)
+				}
+				if h, _ := bc.PrunedHeight(); h != step.prunedHeight {
+					t.Errorf("step %d: pruned height %d, want %d", i, h, step.prunedHeight)
+				}
+			}
+
+			for height, blk := range mainChain(t, bc) {
+				pruned, err := bc.IsPruned(blk.Hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := height >= 1 && height <= 6 //创世块永远不裁剪
+				if pruned != want || (len(blk.Data) == 0) != want {
+					t.Errorf("height %d: pruned = %v, data %q; want pruned = %v", height, pruned, blk.Data, want)
+				}
+			}
+
+			report, err := bc.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() {
+				t.Errorf("Verify after prune: %v", report.Problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================链的修复===========================================
+/**
+tip（键 "l"）或者某个块的 PrevBlockHash 指向一个不存在或者无法解码的键时，迭代器会在那里返回错误，
+整条链后面的内容都读不出来了，但存储中的其他块通常还是完好的。Repair 不依赖 tip，而是：
+1.扫描存储中的全部区块，无法解码的条目记录下来并跳过（BoltStore 的 ScanBlocks）
+2.检查每个块：存储的键要等于区块哈希，工作量证明要有效（区块体不可读时只检查哈希是否满足难度）
+3.从创世块出发，沿着 PrevBlockHash 的反方向找出所有能到达的有效块，其中最高的块作为新的 tip
+4.高度相同时优先保留原来的 tip，否则选时间戳最早的那个，再相同就选哈希最小的，保证结果是确定的
+5.重建高度索引，开启了搜索索引时也一并重建
+有效但到不了创世块的块（祖先缺失或者无效）记为孤块，它们留在存储中，只出现在报告里。
+*/
+
+var ErrNoGenesis = errors.New("no valid genesis block found in the store")
+
+// RepairEntry 是修复报告中的一个条目
+type RepairEntry struct {
+	Key    []byte //存储中的键
+	Reason string
+}
+
+func (e RepairEntry) String() string {
+	return fmt.Sprintf("%x: %s", e.Key, e.Reason)
+}
+
+// RepairReport 是一次修复的结果
+type RepairReport struct {
+	Stored      int           //存储中的条目数
+	Reachable   int           //能从创世块到达的有效块数，包括分叉上的块
+	Undecodable []RepairEntry //无法解码或解密的条目
+	Invalid     []RepairEntry //键和哈希不一致或者工作量证明无效的块
+	Orphaned    []RepairEntry //有效但到不了创世块的块
+	Genesis     []byte
+	OldTip      []byte
+	NewTip      []byte
+	Height      int  //新 tip 的高度
+	Changed     bool //tip 或高度索引是否需要修改（dryRun 时没有真正写入）
+}
+
+// 找出从创世块可以到达的最长有效链，把 tip 和高度索引重置到这条链上，dryRun 为 true 时只生成报告
+// 返回的 error 表示存储读写失败或者找不到创世块，链本身的问题都记录在报告里
+func (bc *Blockchain) Repair(dryRun bool) (*RepairReport, error) {
+	report := &RepairReport{}
+
+	blocks := make(map[string]*block.Block)
+	collect := func(key []byte, b *block.Block, err error) error {
+		report.Stored++
+		if err != nil {
+			report.Undecodable = append(report.Undecodable, RepairEntry{Key: key, Reason: scanReason(err)})
+			return nil
+		}
+		blocks[string(key)] = b
+
+		return nil
+	}
+	err := bc.scanBlocks(collect)
+	if err != nil {
+		return nil, err
+	}
+
+	//按键排序，报告中条目的顺序才是确定的
+	keys := make([]string, 0, len(blocks))
+	for key := range blocks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	children := make(map[string][]string)
+	for _, key := range keys {
+		b := blocks[key]
+		reason, err := bc.checkBlock([]byte(key), b)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			report.Invalid = append(report.Invalid, RepairEntry{Key: []byte(key), Reason: reason})
+			delete(blocks, key)
+			continue
+		}
+		children[string(b.PrevBlockHash)] = append(children[string(b.PrevBlockHash)], key)
+	}
+
+	genesis, err := bc.repairGenesis(blocks, children[""])
+	if err != nil {
+		return nil, err
+	}
+	report.Genesis = genesis
+
+	report.OldTip, err = bc.store.GetTip()
+	if err != nil {
+		return nil, err
+	}
+
+	heights := heightsFrom(string(genesis), children)
+	report.Reachable = len(heights)
+
+	for _, key := range keys {
+		if _, ok := blocks[key]; !ok {
+			continue
+		}
+		if _, ok := heights[key]; !ok {
+			report.Orphaned = append(report.Orphaned, RepairEntry{Key: []byte(key), Reason: orphanReason(blocks, blocks[key])})
+		}
+	}
+
+	newTip := string(genesis)
+	for key := range heights {
+		if betterTip(blocks, heights, key, newTip, report.OldTip) {
+			newTip = key
+		}
+	}
+	report.NewTip = []byte(newTip)
+	report.Height = heights[newTip]
+
+	//新的主链，下标就是高度
+	mainChain := make([][]byte, report.Height+1)
+	for key := newTip; ; key = string(blocks[key].PrevBlockHash) {
+		mainChain[heights[key]] = []byte(key)
+		if heights[key] == 0 {
+			break
+		}
+	}
+
+	report.Changed = !bytes.Equal(report.OldTip, report.NewTip)
+	if !report.Changed {
+		report.Changed, err = bc.heightIndexDiffers(mainChain)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if dryRun || !report.Changed {
+		return report, nil
+	}
+
+	err = bc.resetMainChain(mainChain)
+	if err != nil {
+		return report, err
+	}
+
+	search, err := bc.SearchEnabled()
+	if err != nil || !search {
+		return report, err
+	}
+	_, _, err = bc.RebuildSearchIndex()
+
+	return report, err
+}
+
+// 从 root 开始按层遍历，得到每个可到达块的高度，children 是 父块哈希 -> 子块哈希 的对应关系
+func heightsFrom(root string, children map[string][]string) map[string]int {
+	heights := map[string]int{root: 0}
+	queue := []string{root}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		for _, child := range children[key] {
+			if _, seen := heights[child]; seen {
+				continue
+			}
+			heights[child] = heights[key] + 1
+			queue = append(queue, child)
+		}
+	}
+
+	return heights
+}
+
+// 检查单个存储的块，返回它无效的原因，有效时返回空字符串
+func (bc *Blockchain) checkBlock(key []byte, b *block.Block) (string, error) {
+	if !bytes.Equal(key, b.Hash) {
+		return fmt.Sprintf("stored under this key but block hash is %x", b.Hash), nil
+	}
+
+	hasBody, err := bc.HasBody(key)
+	if err != nil {
+		return "", err
+	}
+	proof := bc.Proof(b)
+	if !hasBody {
+		if !proof.HashMeetsTarget() {
+			return fmt.Sprintf("hash does not meet the %d target bits", bc.targetBits), nil
+		}
+		return "", nil
+	}
+	if !bytes.Equal(proof.Hash(), b.Hash) || !proof.Validate() {
+		return fmt.Sprintf("proof of work is invalid for %d target bits", bc.targetBits), nil
+	}
+
+	return "", nil
+}
+
+// 确定创世块：优先使用元数据中记录的哈希，没有记录时要求存储中恰好有一个创世块
+func (bc *Blockchain) repairGenesis(blocks map[string]*block.Block, candidates []string) ([]byte, error) {
+	recorded, err := bc.GenesisHash()
+	if err != nil {
+		return nil, err
+	}
+	if len(recorded) != 0 {
+		if _, ok := blocks[string(recorded)]; !ok {
+			return nil, fmt.Errorf("%w: recorded genesis %x is missing or invalid", ErrNoGenesis, recorded)
+		}
+		return recorded, nil
+	}
+
+	var found []string
+	for _, key := range candidates {
+		data := blocks[key].Data
+		if string(data) == genesisData || data == nil {
+			found = append(found, key)
+		}
+	}
+	if len(found) != 1 {
+		return nil, fmt.Errorf("%w: %d candidates and no genesis hash recorded", ErrNoGenesis, len(found))
+	}
+
+	return []byte(found[0]), nil
+}
+
+// 孤块到不了创世块的原因：父块不存在还是父块本身也是孤块
+func orphanReason(blocks map[string]*block.Block, b *block.Block) string {
+	if len(b.PrevBlockHash) == 0 {
+		return "genesis-like block that is not the chain's genesis"
+	}
+	if _, ok := blocks[string(b.PrevBlockHash)]; !ok {
+		return fmt.Sprintf("parent %x is missing or invalid", b.PrevBlockHash)
+	}
+
+	return fmt.Sprintf("parent %x is orphaned", b.PrevBlockHash)
+}
+
+// candidate 是否比 current 更适合作为 tip
+func betterTip(blocks map[string]*block.Block, heights map[string]int, candidate, current string, oldTip []byte) bool {
+	if heights[candidate] != heights[current] {
+		return heights[candidate] > heights[current]
+	}
+	if current == string(oldTip) || candidate == string(oldTip) {
+		return candidate == string(oldTip)
+	}
+	if blocks[candidate].Timestamp != blocks[current].Timestamp {
+		return blocks[candidate].Timestamp < blocks[current].Timestamp
+	}
+
+	return candidate < current
+}
+
+// 高度索引是否和给定的主链不一致
+func (bc *Blockchain) heightIndexDiffers(mainChain [][]byte) (bool, error) {
+	for height, hash := range mainChain {
+		indexed, err := bc.store.GetIndex(store.HeightsIndex, store.HeightKey(height))
+		if err != nil || !bytes.Equal(indexed, hash) {
+			return true, err
+		}
+	}
+	extra, err := bc.store.GetIndex(store.HeightsIndex, store.HeightKey(len(mainChain)))
+
+	return extra != nil, err
+}
+
+// 把主链重置为 mainChain：重建高度索引并设置 tip
+func (bc *Blockchain) resetMainChain(mainChain [][]byte) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	err := bc.store.DropIndex(store.HeightsIndex)
+	if err != nil {
+		return err
+	}
+	for height, hash := range mainChain {
+		err = bc.store.PutIndex(store.HeightsIndex, store.HeightKey(height), hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	tip := mainChain[len(mainChain)-1]
+	err = bc.store.SetTip(tip)
+	if err != nil {
+		return err
+	}
+	bc.tip = tip
+	bc.heights = make(map[string]int)
+
+	return nil
+}
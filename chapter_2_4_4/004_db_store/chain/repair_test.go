@@ -0,0 +1,102 @@
+package chain
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 在 5 个块的链上制造各种损坏：Verify 要发现问题，Repair 要把 tip 重置到从创世块出发最长的有效链上，之后 Verify 通过
+func TestVerifyAndRepair(t *testing.T) {
+	tests := []struct {
+		name     string
+		damage   func(t *testing.T, bc *Blockchain)
+		verifyOK bool
+		changed  bool //Repair 是否修改了 tip 或高度索引
+		height   int  //修复后的高度
+		invalid  int  //报告中无效的块数
+		orphaned int  //报告中到不了创世块的块数
+	}{
+		{"intact", func(t *testing.T, bc *Blockchain) {}, true, false, 5, 0, 0},
+		{"tip points to a missing block", func(t *testing.T, bc *Blockchain) {
+			err := bc.store.SetTip(bytes.Repeat([]byte{0xee}, 32))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}, false, true, 5, 0, 0},
+		{"tampered data", func(t *testing.T, bc *Blockchain) {
+			b, err := bc.store.GetBlock(mustHashAtHeight(t, bc, 3))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.Data = []byte("send 1000BTC to Pig")
+			err = bc.store.PutBlock(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}, false, true, 2, 1, 2}, //块 4、5 的祖先无效
+		{"tip rolled back", func(t *testing.T, bc *Blockchain) {
+			err := bc.store.SetTip(mustHashAtHeight(t, bc, 2))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}, true, true, 5, 0, 0}, //后面的块还在，重新成为主链
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newMemoryChain(t)
+			mustAddBlocks(t, bc, "one", "two", "three", "four", "five")
+			tt.damage(t, bc)
+			//重新打开，tip 从存储中读取
+			bc, err := New(bc.store, testConfig(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := bc.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.OK() != tt.verifyOK {
+				t.Errorf("Verify OK = %v, want %v, problems %v", report.OK(), tt.verifyOK, report.Problems)
+			}
+
+			//dry run 只生成报告
+			tip := bc.Tip()
+			dry, err := bc.Repair(true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dry.Changed != tt.changed || !bytes.Equal(bc.Tip(), tip) {
+				t.Errorf("dry run: changed = %v, want %v; tip moved %v", dry.Changed, tt.changed, !bytes.Equal(bc.Tip(), tip))
+			}
+
+			repair, err := bc.Repair(false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repair.Height != tt.height || len(repair.Invalid) != tt.invalid || len(repair.Orphaned) != tt.orphaned {
+				t.Errorf("repair: height %d, %d invalid, %d orphaned; want %d, %d, %d",
+					repair.Height, len(repair.Invalid), len(repair.Orphaned), tt.height, tt.invalid, tt.orphaned)
+			}
+			if height := mustHeight(t, bc); height != tt.height {
+				t.Errorf("height after repair = %d, want %d", height, tt.height)
+			}
+
+			report, err = bc.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() {
+				t.Errorf("verify after repair: %v", report.Problems)
+			}
+			again, err := bc.Repair(true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.Changed {
+				t.Error("a second repair would still change the chain")
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================搜索索引===========================================
+/**
+想知道哪个块的 Data 里包含某个词，以前只能把所有区块解码一遍。
+search 索引是一个倒排索引：把 Data 按字母和数字切成小写的词，每个词对应包含它的区块，键的格式为
+	词 + 0x00 + 区块哈希（32 字节的 SHA-256）
+值为空。bolt 中的键按字节序排列，同一个词的所有区块挨在一起，按前缀遍历就能实现精确匹配和前缀匹配。
+1.索引是可选的，开启后（元数据 searchindex 为 1）它作为 ChainIndex 随主链连接、断开区块自动更新
+2.可以随时从主链重新建立索引，已经被裁剪了区块体的块无法再被索引
+3.查询多个词时取交集，以 * 结尾的词按前缀匹配
+*/
+
+const (
+	searchIndexName  = store.SearchIndex
+	searchEnabledKey = "searchindex"
+	//过长的词不进入索引
+	maxTokenLength = 64
+)
+
+var (
+	ErrSearchDisabled    = errors.New("search index is not enabled")
+	ErrEncryptedNoSearch = errors.New("search index is not available for encrypted chains")
+)
+
+// SearchResult 是一个匹配的区块
+type SearchResult struct {
+	Hash      []byte
+	Height    int
+	Timestamp int64
+}
+
+// 把区块数据切分成去重后的小写词
+func tokenize(data []byte) []string {
+	fields := strings.FieldsFunc(strings.ToLower(string(data)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, f := range fields {
+		if len(f) > maxTokenLength || seen[f] {
+			continue
+		}
+		seen[f] = true
+		tokens = append(tokens, f)
+	}
+
+	return tokens
+}
+
+func searchKey(token string, hash []byte) []byte {
+	key := append([]byte(token), 0)
+	return append(key, hash...)
+}
+
+// searchIndex 维护主链区块数据的倒排索引
+type searchIndex struct {
+	store store.BlockStore
+}
+
+func (idx searchIndex) ConnectBlock(b *block.Block, height int) error {
+	for _, token := range tokenize(b.Data) {
+		err := idx.store.PutIndex(searchIndexName, searchKey(token, b.Hash), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (idx searchIndex) DisconnectBlock(b *block.Block, height int) error {
+	for _, token := range tokenize(b.Data) {
+		err := idx.store.DeleteIndex(searchIndexName, searchKey(token, b.Hash))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 搜索索引是否已经开启
+func (bc *Blockchain) SearchEnabled() (bool, error) {
+	enabled, err := bc.metaInt(searchEnabledKey, 0)
+	return enabled == 1, err
+}
+
+// 从主链重新建立搜索索引并开启它，返回索引的块数和因为被裁剪而跳过的块数
+func (bc *Blockchain) RebuildSearchIndex() (indexed, skipped int, err error) {
+	if bc.Encrypted() {
+		return 0, 0, ErrEncryptedNoSearch
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	err = bc.store.DropIndex(searchIndexName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	idx := searchIndex{bc.store}
+	tipHeight, err := bc.heightOf(bc.tip)
+	if err != nil {
+		return 0, 0, err
+	}
+	//持有锁期间主链不会变化，直接按高度索引读取，不能调用会再次加锁的 Blocks
+	for height := 0; height <= tipHeight; height++ {
+		hash, err := bc.HashAtHeight(height)
+		if err != nil {
+			return indexed, skipped, fmt.Errorf("height %d: %w", height, err)
+		}
+		b, err := bc.store.GetBlock(hash)
+		if err != nil {
+			return indexed, skipped, err
+		}
+		hasBody, err := bc.HasBody(hash)
+		if err != nil {
+			return indexed, skipped, err
+		}
+		if !hasBody {
+			skipped++
+			continue
+		}
+		err = idx.ConnectBlock(b, height)
+		if err != nil {
+			return indexed, skipped, err
+		}
+		indexed++
+	}
+
+	err = bc.store.PutMeta(searchEnabledKey, block.IntToHex(1))
+	if err != nil {
+		return indexed, skipped, err
+	}
+	if !bc.hasSearchIndex() {
+		bc.AddIndex(idx)
+	}
+
+	return indexed, skipped, nil
+}
+
+// 关闭并删除搜索索引
+func (bc *Blockchain) DropSearchIndex() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	err := bc.store.PutMeta(searchEnabledKey, block.IntToHex(0))
+	if err != nil {
+		return err
+	}
+	for i, idx := range bc.indexes {
+		if _, ok := idx.(searchIndex); ok {
+			bc.indexes = append(bc.indexes[:i:i], bc.indexes[i+1:]...)
+			break
+		}
+	}
+
+	return bc.store.DropIndex(searchIndexName)
+}
+
+func (bc *Blockchain) hasSearchIndex() bool {
+	for _, idx := range bc.indexes {
+		if _, ok := idx.(searchIndex); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 搜索 Data 中同时包含所有查询词的主链区块，按高度排序
+func (bc *Blockchain) Search(query string) ([]SearchResult, error) {
+	enabled, err := bc.SearchEnabled()
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrSearchDisabled
+	}
+
+	if len(strings.Fields(query)) == 0 {
+		return nil, errors.New("empty search query")
+	}
+
+	var matches map[string]bool
+	for _, term := range strings.Fields(query) {
+		prefix := strings.HasSuffix(term, "*")
+		tokens := tokenize([]byte(strings.TrimSuffix(term, "*")))
+		if len(tokens) != 1 {
+			return nil, fmt.Errorf("invalid search term %q", term)
+		}
+
+		key := []byte(tokens[0])
+		if !prefix {
+			key = append(key, 0)
+		}
+		found := make(map[string]bool)
+		err = bc.store.ScanIndex(searchIndexName, key, func(k, v []byte) error {
+			if len(k) < len(key)+sha256.Size {
+				return nil
+			}
+			hash := string(k[len(k)-sha256.Size:])
+			if matches == nil || matches[hash] {
+				found[hash] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		matches = found
+	}
+
+	var results []SearchResult
+	for hash := range matches {
+		result, ok, err := bc.searchResult([]byte(hash))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Height < results[j].Height
+	})
+
+	return results, nil
+}
+
+// 只返回仍然在主链上的块，索引中可能残留被重组断开但区块体已经裁剪的块
+func (bc *Blockchain) searchResult(hash []byte) (SearchResult, bool, error) {
+	b, err := bc.store.GetBlock(hash)
+	if errors.Is(err, store.ErrBlockNotFound) {
+		return SearchResult{}, false, nil
+	}
+	if err != nil {
+		return SearchResult{}, false, err
+	}
+
+	bc.mu.Lock()
+	height, err := bc.heightOf(hash)
+	bc.mu.Unlock()
+	if err != nil {
+		return SearchResult{}, false, err
+	}
+	onMain, err := bc.HashAtHeight(height)
+	if err != nil && !errors.Is(err, store.ErrBlockNotFound) {
+		return SearchResult{}, false, err
+	}
+	if !bytes.Equal(onMain, hash) {
+		return SearchResult{}, false, nil
+	}
+
+	return SearchResult{b.Hash, height, b.Timestamp}, true, nil
+}
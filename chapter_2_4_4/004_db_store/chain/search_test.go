@@ -0,0 +1,127 @@
+package chain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"test/blockchain-project/004_db_store/store"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"Send 1 BTC to Pig", []string{"send", "1", "btc", "to", "pig"}},
+		{"pig, PIG; pig!", []string{"pig"}},
+		{"转账 1BTC", []string{"转账", "1btc"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		if got := tokenize([]byte(tt.data)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+// 查询结果的高度
+func searchHeights(t *testing.T, bc *Blockchain, query string) ([]int, error) {
+	t.Helper()
+	results, err := bc.Search(query)
+	if err != nil {
+		return nil, err
+	}
+	var heights []int
+	for _, r := range results {
+		heights = append(heights, r.Height)
+	}
+
+	return heights, nil
+}
+
+func TestSearch(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			bc := newTestChain(t, backend.newStore(t))
+			mustAddBlocks(t, bc, "Send 1 BTC to Pig")
+			mustAddBlocks(t, bc, "send 2 btc to Dog")
+
+			if _, err := bc.Search("btc"); !errors.Is(err, ErrSearchDisabled) {
+				t.Fatalf("Search before enabling: err = %v, want ErrSearchDisabled", err)
+			}
+			indexed, skipped, err := bc.RebuildSearchIndex()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if indexed != 3 || skipped != 0 {
+				t.Errorf("RebuildSearchIndex = %d indexed, %d skipped, want 3, 0", indexed, skipped)
+			}
+			//开启以后新的块自动进入索引
+			mustAddBlocks(t, bc, "Pigeon post")
+
+			tests := []struct {
+				query string
+				want  []int
+				ok    bool
+			}{
+				{"btc", []int{1, 2}, true},
+				{"BTC pig", []int{1}, true},
+				{"pig*", []int{1, 3}, true},
+				{"pig", []int{1}, true},
+				{"genesis", []int{0}, true},
+				{"cat", nil, true},
+				{"btc cat", nil, true},
+				{"", nil, false},
+				{"to-pig", nil, false}, //一个查询词只能是一个词
+			}
+			for _, tt := range tests {
+				got, err := searchHeights(t, bc, tt.query)
+				if (err == nil) != tt.ok {
+					t.Errorf("Search(%q) err = %v, want ok = %v", tt.query, err, tt.ok)
+					continue
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+				}
+			}
+
+			if err := bc.DropSearchIndex(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := bc.Search("btc"); !errors.Is(err, ErrSearchDisabled) {
+				t.Errorf("Search after dropping: err = %v, want ErrSearchDisabled", err)
+			}
+		})
+	}
+}
+
+// 被重组断开的块不能再出现在结果中，新主链上的块要能被搜到
+func TestSearchAfterReorg(t *testing.T) {
+	bc := newTestChain(t, store.NewMemoryStore())
+	genesis := bc.Tip()
+	mustAddBlocks(t, bc, "old branch")
+	if _, _, err := bc.RebuildSearchIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := genesis
+	for _, data := range []string{"new branch", "new branch again"} {
+		b, _, err := bc.AddBlockOn(parent, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent = b.Hash
+	}
+
+	for query, want := range map[string][]int{"old": nil, "new": {1, 2}, "branch": {1, 2}} {
+		got, err := searchHeights(t, bc, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Search(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package chain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/pow"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================链的导出与导入===========================================
+/**
+以前要把一条链搬到另一台机器上，只能在没有进程打开它的时候直接拷贝 bolt 文件。
+现在可以把链导出成一个与 bolt 无关的快照文件，格式如下（整数都是大端序）：
+1.文件头：4 字节魔数 "BCEX" 和 1 字节版本号，后面一帧是 JSON 编码的链参数 target_bits、hash_algorithm 和 chain_id
+2.从创世块开始，每个块一帧：4 字节长度 + Block.Serialize() 的结果
+3.文件尾：长度为 0 的一帧作为结束标记，后面跟 32 字节的 SHA-256，校验它之前的全部内容
+导入时只能导入到一条新链中，链参数和新建链时一样写入元数据，每个块都按这些参数重新执行 ProofOfWork.Validate
+并检查 PrevBlockHash，遇到第一个无效的块就停止，在它之前的块保留下来。
+版本 1 的快照没有链参数，仍然可以导入，这时按导入配置中的难度和 SHA-256 校验。
+*/
+
+const snapshotVersion = 2
+
+// 没有链参数的旧版本
+const snapshotVersionNoParams = 1
+
+var snapshotMagic = []byte("BCEX")
+
+// 单个块序列化后的最大长度，防止损坏的长度字段导致分配过大的内存
+const maxSnapshotFrame = 32 << 20
+
+var (
+	ErrSnapshotFormat   = errors.New("not a chain snapshot or unsupported version")
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+	ErrSnapshotPruned   = errors.New("chain has pruned block bodies and cannot be exported")
+	ErrStoreNotEmpty    = errors.New("import target already contains a chain")
+)
+
+// 快照文件头中的链参数，与创世块配置中的同名字段含义相同
+type snapshotParams struct {
+	TargetBits    int    `json:"target_bits"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	ChainID       string `json:"chain_id,omitempty"`
+}
+
+// 把主链从创世块开始写入 w，返回写入的块数
+func (bc *Blockchain) Export(w io.Writer) (int, error) {
+	//裁剪过的块没有区块体，无法导出
+	prunedHeight, err := bc.PrunedHeight()
+	if err != nil {
+		return 0, err
+	}
+	if prunedHeight >= 0 {
+		return 0, fmt.Errorf("%w: bodies are pruned up to height %d", ErrSnapshotPruned, prunedHeight)
+	}
+
+	chainID, err := bc.ChainID()
+	if err != nil {
+		return 0, err
+	}
+	params, err := json.Marshal(snapshotParams{TargetBits: bc.targetBits, HashAlgorithm: bc.hashName, ChainID: chainID})
+	if err != nil {
+		return 0, err
+	}
+
+	checksum := sha256.New()
+	out := bufio.NewWriter(io.MultiWriter(w, checksum))
+	_, err = out.Write(append(append([]byte{}, snapshotMagic...), snapshotVersion))
+	if err != nil {
+		return 0, err
+	}
+	err = writeFrame(out, params)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for b, err := range bc.Blocks(GenesisRef, TipRef) {
+		if err != nil {
+			return count, err
+		}
+		hasBody, err := bc.HasBody(b.Hash)
+		if err != nil {
+			return count, err
+		}
+		if !hasBody {
+			return count, &block.Error{Hash: b.Hash, Err: store.ErrNoPassphrase}
+		}
+		serialized, err := b.Serialize()
+		if err != nil {
+			return count, err
+		}
+		err = writeFrame(out, serialized)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	err = writeFrame(out, nil)
+	if err != nil {
+		return count, err
+	}
+	err = out.Flush()
+	if err != nil {
+		return count, err
+	}
+	_, err = w.Write(checksum.Sum(nil))
+
+	return count, err
+}
+
+// 把快照导入到一个空的存储中，返回导入的块数，区块按快照记录的链参数校验
+func Import(s store.BlockStore, r io.Reader, cfg Config) (int, error) {
+	targetBits, err := cfg.targetBits()
+	if err != nil {
+		return 0, err
+	}
+	tip, err := s.GetTip()
+	if err != nil {
+		return 0, err
+	}
+	if tip != nil {
+		return 0, ErrStoreNotEmpty
+	}
+
+	checksum := sha256.New()
+	in := io.TeeReader(bufio.NewReader(r), checksum)
+	header := make([]byte, len(snapshotMagic)+1)
+	_, err = io.ReadFull(in, header)
+	if err != nil || !bytes.Equal(header[:len(snapshotMagic)], snapshotMagic) {
+		return 0, ErrSnapshotFormat
+	}
+	params, err := readSnapshotParams(in, header[len(snapshotMagic)], targetBits)
+	if err != nil {
+		return 0, err
+	}
+
+	var bc *Blockchain
+	count := 0
+	for {
+		frame, err := readFrame(in)
+		if err != nil {
+			return count, fmt.Errorf("reading block at height %d: %w", count, err)
+		}
+		if frame == nil {
+			break
+		}
+
+		var b block.Block
+		err = gob.NewDecoder(bytes.NewReader(frame)).Decode(&b)
+		if err != nil {
+			return count, fmt.Errorf("block at height %d cannot be decoded: %w: %v", count, block.ErrCorrupt, err)
+		}
+
+		if count == 0 {
+			err = importGenesis(s, &b, params)
+			if err != nil {
+				return count, err
+			}
+			bc, err = New(s, cfg)
+			if err != nil {
+				return count, err
+			}
+		} else {
+			if tip := bc.Tip(); !bytes.Equal(b.PrevBlockHash, tip) {
+				return count, fmt.Errorf("%w: block %x at height %d does not link to %x", block.ErrInvalid, b.Hash, count, tip)
+			}
+			_, err = bc.ProcessBlock(&b)
+			if err != nil {
+				return count, fmt.Errorf("block at height %d: %w", count, err)
+			}
+		}
+		count++
+	}
+
+	return count, verifyChecksum(in, checksum)
+}
+
+// 读取文件头之后的链参数，版本 1 的快照没有记录，使用 targetBits 和默认的哈希算法
+func readSnapshotParams(in io.Reader, version byte, targetBits int) (*snapshotParams, error) {
+	switch version {
+	case snapshotVersionNoParams:
+		return &snapshotParams{TargetBits: targetBits, HashAlgorithm: pow.DefaultHash}, nil
+	case snapshotVersion:
+	default:
+		return nil, ErrSnapshotFormat
+	}
+
+	frame, err := readFrame(in)
+	if err != nil || frame == nil {
+		return nil, fmt.Errorf("%w: missing chain parameters", ErrSnapshotFormat)
+	}
+	params := &snapshotParams{}
+	decoder := json.NewDecoder(bytes.NewReader(frame))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: chain parameters: %v", ErrSnapshotFormat, err)
+	}
+	g := Genesis{TargetBits: params.TargetBits, HashAlgorithm: params.HashAlgorithm}
+	err = g.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSnapshotFormat, err)
+	}
+
+	return params, nil
+}
+
+// 按快照的链参数校验创世块，然后像 createGenesis 一样写入创世块和链参数的元数据
+func importGenesis(s store.BlockStore, genesis *block.Block, params *snapshotParams) error {
+	hash, err := pow.LookupHash(params.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	proof := pow.NewWithHash(genesis, params.TargetBits, hash)
+	if len(genesis.PrevBlockHash) != 0 {
+		return fmt.Errorf("%w: first block %x is not a genesis block", block.ErrInvalid, genesis.Hash)
+	}
+	if !proof.Validate() || !bytes.Equal(proof.Hash(), genesis.Hash) {
+		return fmt.Errorf("%w: %w: proof of work does not match genesis hash %x", block.ErrInvalid, pow.ErrInvalid, genesis.Hash)
+	}
+
+	err = s.PutBlock(genesis)
+	if err != nil {
+		return err
+	}
+	err = s.PutIndex(store.HeightsIndex, store.HeightKey(0), genesis.Hash)
+	if err != nil {
+		return err
+	}
+
+	meta := map[string][]byte{
+		store.GenesisHashKey:   genesis.Hash,
+		store.TargetBitsKey:    block.IntToHex(int64(params.TargetBits)),
+		store.HashAlgorithmKey: []byte(params.HashAlgorithm),
+	}
+	if params.ChainID != "" {
+		meta[store.ChainIDKey] = []byte(params.ChainID)
+	}
+	for key, value := range meta {
+		err = s.PutMeta(key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.SetTip(genesis.Hash)
+}
+
+// 结束标记之后是前面所有内容的 SHA-256
+func verifyChecksum(in io.Reader, checksum hash.Hash) error {
+	expected := checksum.Sum(nil)
+	trailer := make([]byte, sha256.Size)
+	_, err := io.ReadFull(in, trailer)
+	if err != nil {
+		return fmt.Errorf("%w: missing trailer", ErrSnapshotChecksum)
+	}
+	if !bytes.Equal(trailer, expected) {
+		return ErrSnapshotChecksum
+	}
+
+	return nil
+}
+
+func writeFrame(w io.Writer, payload []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+	_, err := w.Write(length[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+
+	return err
+}
+
+// 读取一帧，读到结束标记时返回 nil
+func readFrame(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	_, err := io.ReadFull(r, length[:])
+	if err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n == 0 {
+		return nil, nil
+	}
+	if n > maxSnapshotFrame {
+		return nil, fmt.Errorf("frame of %d bytes is too large", n)
+	}
+
+	payload := make([]byte, n)
+	_, err = io.ReadFull(r, payload)
+
+	return payload, err
+}
@@ -0,0 +1,179 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+
+	"test/blockchain-project/004_db_store/pow"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 导出再导入得到同样的主链，链的参数来自快照而不是导入时的配置
+func TestSnapshotRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		genesis *Genesis
+	}{
+		{"default", nil},
+		{"sha3 with chain id", &Genesis{Data: "team genesis", Timestamp: 1700000000, TargetBits: 5, HashAlgorithm: "sha3-256", ChainID: "team"}},
+		{"sha256d", &Genesis{Data: "double", Timestamp: 1700000000, TargetBits: 3, HashAlgorithm: "sha256d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Genesis = tt.genesis
+			source, err := New(store.NewMemoryStore(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustAddBlocks(t, source, "send 1BTC to Pig", "send 2BTC to Dog", "")
+
+			var snapshot bytes.Buffer
+			exported, err := source.Export(&snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			//导入时的配置是另一个难度，应该被快照中记录的参数覆盖
+			importCfg := testConfig(t)
+			importCfg.TargetBits = testTargetBits + 7
+			s := store.NewMemoryStore()
+			imported, err := Import(s, &snapshot, importCfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if imported != exported || imported != 4 {
+				t.Errorf("exported %d, imported %d blocks, want 4", exported, imported)
+			}
+
+			bc, err := New(s, importCfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bc.TargetBits() != source.TargetBits() || bc.HashAlgorithm() != source.HashAlgorithm() {
+				t.Errorf("imported params %d %s, want %d %s", bc.TargetBits(), bc.HashAlgorithm(), source.TargetBits(), source.HashAlgorithm())
+			}
+			sourceID, err := source.ChainID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := bc.ChainID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != sourceID {
+				t.Errorf("chain id = %q, want %q", id, sourceID)
+			}
+			for height := 0; height <= 3; height++ {
+				if got, want := mustHashAtHeight(t, bc, height), mustHashAtHeight(t, source, height); !bytes.Equal(got, want) {
+					t.Errorf("height %d: %x, want %x", height, got, want)
+				}
+			}
+			report, err := bc.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() {
+				t.Errorf("verify imported chain: %v", report.Problems)
+			}
+		})
+	}
+}
+
+func TestSnapshotDamaged(t *testing.T) {
+	source := newMemoryChain(t)
+	mustAddBlocks(t, source, "one", "two")
+	var snapshot bytes.Buffer
+	_, err := source.Export(&snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := snapshot.Bytes()
+
+	tests := []struct {
+		name   string
+		damage func(b []byte) []byte
+		err    error
+	}{
+		{"bad magic", func(b []byte) []byte { b[0] = 'X'; return b }, ErrSnapshotFormat},
+		{"unknown version", func(b []byte) []byte { b[len(snapshotMagic)] = 99; return b }, ErrSnapshotFormat},
+		{"checksum", func(b []byte) []byte { b[len(b)-1] ^= 1; return b }, ErrSnapshotChecksum},
+		{"truncated trailer", func(b []byte) []byte { return b[:len(b)-10] }, ErrSnapshotChecksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			damaged := tt.damage(bytes.Clone(data))
+			_, err := Import(store.NewMemoryStore(), bytes.NewReader(damaged), testConfig(t))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Import error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	//只能导入到空的存储中
+	_, err = Import(source.store, bytes.NewReader(data), testConfig(t))
+	if !errors.Is(err, ErrStoreNotEmpty) {
+		t.Errorf("Import into a chain error = %v, want ErrStoreNotEmpty", err)
+	}
+}
+
+func TestExportPruned(t *testing.T) {
+	bc := newMemoryChain(t)
+	mustAddBlocks(t, bc, "1", "2", "3", "4", "5", "6", "7", "8")
+	_, err := bc.SetPruneDepth(minPruneDepth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = bc.Export(&bytes.Buffer{})
+	if !errors.Is(err, ErrSnapshotPruned) {
+		t.Errorf("Export error = %v, want ErrSnapshotPruned", err)
+	}
+}
+
+// 版本 1 的快照没有链参数，按导入配置中的难度校验
+func TestSnapshotVersion1(t *testing.T) {
+	source := newMemoryChain(t)
+	mustAddBlocks(t, source, "one")
+	var snapshot bytes.Buffer
+	_, err := source.Export(&snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//去掉参数帧，改写版本号，重新计算校验和
+	data := snapshot.Bytes()
+	header := len(snapshotMagic) + 1
+	paramsLen := int(binary.BigEndian.Uint32(data[header:]))
+	v1 := slices.Concat(snapshotMagic, []byte{snapshotVersionNoParams}, data[header+4+paramsLen:len(data)-sha256.Size])
+	sum := sha256.Sum256(v1)
+	v1 = append(v1, sum[:]...)
+
+	tests := []struct {
+		name       string
+		targetBits int
+		err        error
+	}{
+		{"same difficulty", testTargetBits, nil},
+		{"other difficulty", testTargetBits + 16, pow.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.TargetBits = tt.targetBits
+			count, err := Import(store.NewMemoryStore(), bytes.NewReader(v1), cfg)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Import error = %v, want %v", err, tt.err)
+			}
+			if err == nil && count != 2 {
+				t.Errorf("imported %d blocks, want 2", count)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package chain
+
+import (
+	"math"
+	"math/bits"
+)
+
+//==========================================链的统计===========================================
+/**
+以前想知道链的运行情况只能盯着 printchain 的输出看。Stats 把主链从创世块走到 tip，统计：
+1.区块数，序列化后的总大小、平均、最小和最大值（区块体不可读的块只算区块头）
+2.相邻两个块时间戳的间隔：平均、最小和最大值
+3.平均 Nonce，以及按难度估计挖出一个块平均需要计算的哈希次数：哈希小于目标的概率是 2^-targetBits，所以期望是 2^targetBits 次
+4.大小、间隔和 Nonce 的分布，按 2 的幂分桶：[0,1)、[1,2)、[2,4)、[4,8)……，时间戳倒退得到的负间隔归入第一个桶
+字段带有 json 标签，stats -json 直接输出这个结构，字段名不要随意修改。
+*/
+
+// HistogramBucket 是分布中的一个桶，包含 Min，不包含 Max
+type HistogramBucket struct {
+	Min   int64 `json:"min"`
+	Max   int64 `json:"max"`
+	Count int   `json:"count"`
+}
+
+// Summary 是一组数值的汇总
+type Summary struct {
+	Total     int64             `json:"total"`
+	Average   float64           `json:"average"`
+	Min       int64             `json:"min"`
+	Max       int64             `json:"max"`
+	Histogram []HistogramBucket `json:"histogram"`
+}
+
+// ChainStats 是主链的统计信息
+type ChainStats struct {
+	Blocks         int     `json:"blocks"`
+	Height         int     `json:"height"`
+	HeadersOnly    int     `json:"headers_only"` //区块体被裁剪或加密的块数
+	TargetBits     int     `json:"target_bits"`
+	HashAlgorithm  string  `json:"hash_algorithm"`
+	ExpectedHashes float64 `json:"expected_hashes"` //按难度估计的每个块的哈希次数
+	Size           Summary `json:"size"`            //序列化后的字节数
+	Interval       Summary `json:"interval"`        //与父块的时间戳间隔（秒），创世块没有
+	Nonce          Summary `json:"nonce"`
+}
+
+// 统计主链上的全部区块
+func (bc *Blockchain) Stats() (*ChainStats, error) {
+	stats := &ChainStats{
+		TargetBits:     bc.targetBits,
+		HashAlgorithm:  bc.hashName,
+		ExpectedHashes: math.Exp2(float64(bc.targetBits)),
+	}
+
+	var sizes, intervals, nonces []int64
+	var prevTimestamp int64
+	for b, err := range bc.Blocks(GenesisRef, TipRef) {
+		if err != nil {
+			return nil, err
+		}
+
+		serialized, err := b.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		hasBody, err := bc.HasBody(b.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if !hasBody {
+			stats.HeadersOnly++
+		}
+
+		sizes = append(sizes, int64(len(serialized)))
+		nonces = append(nonces, int64(b.Nonce))
+		if stats.Blocks > 0 {
+			intervals = append(intervals, b.Timestamp-prevTimestamp)
+		}
+		prevTimestamp = b.Timestamp
+		stats.Blocks++
+	}
+	stats.Height = stats.Blocks - 1
+
+	stats.Size = summarize(sizes)
+	stats.Interval = summarize(intervals)
+	stats.Nonce = summarize(nonces)
+
+	return stats, nil
+}
+
+func summarize(values []int64) Summary {
+	if len(values) == 0 {
+		return Summary{}
+	}
+
+	s := Summary{Min: values[0], Max: values[0]}
+	for _, v := range values {
+		s.Total += v
+		s.Min = min(s.Min, v)
+		s.Max = max(s.Max, v)
+	}
+	s.Average = float64(s.Total) / float64(len(values))
+	s.Histogram = histogram(values)
+
+	return s
+}
+
+// 按 2 的幂分桶，只保留第一个和最后一个非空桶之间的桶
+func histogram(values []int64) []HistogramBucket {
+	//桶 i（i > 0）是 [2^(i-1), 2^i)，最后一个桶的上界用 MaxInt64 代替 2^63
+	var buckets [64]HistogramBucket
+	for i := range buckets {
+		if i > 0 {
+			buckets[i].Min = 1 << (i - 1)
+		}
+		buckets[i].Max = math.MaxInt64
+		if i < 63 {
+			buckets[i].Max = 1 << i
+		}
+	}
+
+	first, last := len(buckets), -1
+	for _, v := range values {
+		i := 0
+		if v > 0 {
+			i = bits.Len64(uint64(v))
+		}
+		buckets[i].Count++
+		if v < buckets[0].Min {
+			buckets[0].Min = v
+		}
+		first = min(first, i)
+		last = max(last, i)
+	}
+
+	return append([]HistogramBucket{}, buckets[first:last+1]...)
+}
@@ -0,0 +1,92 @@
+package chain
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int64
+		want   []HistogramBucket
+	}{
+		{"single zero", []int64{0}, []HistogramBucket{{0, 1, 1}}},
+		{"powers of two", []int64{1, 2, 3, 4, 7, 8}, []HistogramBucket{{1, 2, 1}, {2, 4, 2}, {4, 8, 2}, {8, 16, 1}}},
+		{"gap in the middle", []int64{1, 100}, []HistogramBucket{{1, 2, 1}, {2, 4, 0}, {4, 8, 0}, {8, 16, 0},
+			{16, 32, 0}, {32, 64, 0}, {64, 128, 1}}},
+		{"negative goes to the first bucket", []int64{-5, 0, 1}, []HistogramBucket{{-5, 1, 2}, {1, 2, 1}}},
+		{"largest value", []int64{math.MaxInt64}, []HistogramBucket{{1 << 62, math.MaxInt64, 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := histogram(tt.values); !slices.Equal(got, tt.want) {
+				t.Errorf("histogram(%v) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	if got := summarize(nil); got.Total != 0 || got.Histogram != nil {
+		t.Errorf("summarize(nil) = %+v, want the zero Summary", got)
+	}
+
+	got := summarize([]int64{4, -2, 10})
+	if got.Total != 12 || got.Average != 4 || got.Min != -2 || got.Max != 10 || len(got.Histogram) != 5 {
+		t.Errorf("summarize = %+v", got)
+	}
+}
+
+// 创世块之后的块比父块晚 10s、20s，最后一个块的时间戳比父块早 1s
+func TestStats(t *testing.T) {
+	bc := newMemoryChain(t)
+	genesis, err := bc.store.GetBlock(bc.Tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := genesis.Timestamp
+	for i, interval := range []int64{10, 20, -1} {
+		timestamp += interval
+		b := &block.Block{Timestamp: timestamp, Data: []byte{byte('a' + i)}, PrevBlockHash: bc.Tip()}
+		if err := bc.Proof(b).Mine(nil); err != nil {
+			t.Fatal(err)
+		}
+		_, err := bc.ProcessBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := bc.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Blocks != 4 || stats.Height != 3 || stats.HeadersOnly != 0 {
+		t.Errorf("%d blocks, height %d, %d headers only; want 4, 3, 0", stats.Blocks, stats.Height, stats.HeadersOnly)
+	}
+	if stats.TargetBits != testTargetBits || stats.ExpectedHashes != 1<<testTargetBits || stats.HashAlgorithm != "sha256" {
+		t.Errorf("difficulty %d, %s, %.0f expected hashes", stats.TargetBits, stats.HashAlgorithm, stats.ExpectedHashes)
+	}
+
+	interval := stats.Interval
+	if interval.Total != 29 || interval.Min != -1 || interval.Max != 20 {
+		t.Errorf("interval = %+v, want total 29, min -1, max 20", interval)
+	}
+	wantBuckets := []HistogramBucket{{-1, 1, 1}, {1, 2, 0}, {2, 4, 0}, {4, 8, 0}, {8, 16, 1}, {16, 32, 1}}
+	if !slices.Equal(interval.Histogram, wantBuckets) {
+		t.Errorf("interval histogram = %v, want %v", interval.Histogram, wantBuckets)
+	}
+
+	var count int
+	for _, b := range stats.Size.Histogram {
+		count += b.Count
+	}
+	if count != 4 || stats.Size.Min <= 0 || stats.Size.Min > stats.Size.Max {
+		t.Errorf("size = %+v, want 4 blocks in the histogram", stats.Size)
+	}
+}
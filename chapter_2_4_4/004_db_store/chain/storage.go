@@ -0,0 +1,110 @@
+package chain
+
+import (
+	"errors"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================存储相关的功能===========================================
+/**
+缓存、压缩和加密都是在 store 包里实现的，Blockchain 只看得到 BlockStore 接口。
+下面这些方法在存储是 CachedStore 或 BoltStore 时把对应的功能转交给它们，存储不支持时给出明确的结果：
+1.CacheStats：缓存的命中统计
+2.StorageStats：区块压缩前后占用的空间
+3.HasBody、Encrypted、EnableEncryption：区块体是否可读、加密模式
+4.scanBlocks：遍历全部区块，跳过无法解码的条目
+*/
+
+// 缓存的统计信息，存储没有缓存时 ok 为 false
+func (bc *Blockchain) CacheStats() (stats store.CacheStats, ok bool) {
+	c, ok := bc.store.(*store.CachedStore)
+	if !ok {
+		return store.CacheStats{}, false
+	}
+
+	return c.Stats(), true
+}
+
+// 区块占用空间的统计，存储不是 BoltStore 时 ok 为 false
+func (bc *Blockchain) StorageStats() (stats store.StorageStats, ok bool, err error) {
+	s, ok := bc.boltStore()
+	if !ok {
+		return store.StorageStats{}, false, nil
+	}
+	stats, err = s.StorageStats()
+
+	return stats, true, err
+}
+
+// 区块体是否可以读取：没有被裁剪，也没有因为缺少口令而无法解密
+func (bc *Blockchain) HasBody(hash []byte) (bool, error) {
+	pruned, err := bc.store.IsPruned(hash)
+	if err != nil || pruned {
+		return false, err
+	}
+	if s, ok := bc.boltStore(); ok {
+		locked, err := s.IsLocked(hash)
+		return !locked, err
+	}
+
+	return true, nil
+}
+
+// 链是否开启了加密模式
+func (bc *Blockchain) Encrypted() bool {
+	s, ok := bc.boltStore()
+	return ok && s.Encrypted()
+}
+
+// 开启加密模式，明文的搜索索引会被删除
+func (bc *Blockchain) EnableEncryption(passphrase string) (int, error) {
+	s, ok := bc.boltStore()
+	if !ok {
+		return 0, errors.New("encryption is only available for bolt databases")
+	}
+
+	err := bc.DropSearchIndex()
+	if err != nil {
+		return 0, err
+	}
+	count, err := s.EnableEncryption(passphrase)
+	if c, isCached := bc.store.(*store.CachedStore); isCached {
+		c.Purge()
+	}
+
+	return count, err
+}
+
+// 遍历存储中的全部区块，BoltStore 中无法解码或解密的条目以 err 的形式交给 fn，不会中止遍历
+func (bc *Blockchain) scanBlocks(fn func(key []byte, b *block.Block, err error) error) error {
+	if s, ok := bc.boltStore(); ok {
+		return s.ScanBlocks(fn)
+	}
+
+	return bc.store.ForEach(func(key []byte, b *block.Block) error {
+		return fn(key, b, nil)
+	})
+}
+
+// scanBlocks 交给 fn 的错误去掉区块哈希以后的描述，哈希已经作为键单独给出
+func scanReason(err error) string {
+	var blockErr *block.Error
+	if errors.As(err, &blockErr) {
+		return blockErr.Err.Error()
+	}
+
+	return err.Error()
+}
+
+// 存储底层的 BoltStore，去掉缓存这一层
+func (bc *Blockchain) boltStore() (*store.BoltStore, bool) {
+	backend := bc.store
+	if c, ok := backend.(*store.CachedStore); ok {
+		backend = c.BlockStore
+	}
+	s, ok := backend.(*store.BoltStore)
+
+	return s, ok
+}
@@ -0,0 +1,201 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================全链校验===========================================
+/**
+printchain 只对每个块单独调用 proof.Validate()，并不能发现下面这些问题：
+1.存储中的键和区块自身的 Hash 不一致
+2.区块的 Hash 不是由它自己的内容和 Nonce 算出来的
+3.PrevBlockHash 指向一个不存在的块，或者链里出现了环
+4.时间戳倒退，或者远远超过当前时间
+5.链的尽头不是创世块，或者不是元数据中记录的那个创世块
+Verify 从 tip 开始把整条链走一遍，把发现的每一个问题连同所在的高度和哈希一起记录下来，而不是遇到第一个问题就停止。
+*/
+
+// 允许区块时间戳超过当前时间的最大值，和比特币一样取两小时
+const maxFutureDrift = 2 * time.Hour
+
+// VerifyProblem 是校验中发现的一个问题
+type VerifyProblem struct {
+	Height int    //区块高度（创世块为 0），链没有走到创世块时高度未知，为 -1
+	Depth  int    //距离 tip 的块数，tip 为 0，不在主链上时为 -1
+	Hash   []byte //出问题的区块哈希
+	Reason string
+}
+
+func (p VerifyProblem) String() string {
+	if p.Hash == nil {
+		return p.Reason
+	}
+	if p.Height < 0 && p.Depth < 0 {
+		return fmt.Sprintf("block %x: %s", p.Hash, p.Reason)
+	}
+	if p.Height < 0 {
+		return fmt.Sprintf("depth %d from tip, block %x: %s", p.Depth, p.Hash, p.Reason)
+	}
+
+	return fmt.Sprintf("height %d, block %x: %s", p.Height, p.Hash, p.Reason)
+}
+
+// VerifyReport 是一次全链校验的结果
+type VerifyReport struct {
+	Blocks      int //从 tip 走到的区块数
+	Stored      int //存储中的区块总数
+	Unreachable int //存储中但不在主链上的区块数
+	Pruned      int //主链上区块体已被裁剪、只检查了区块头的块数
+	Locked      int //主链上区块体被加密、没有口令所以只检查了区块头的块数
+	Problems    []VerifyProblem
+}
+
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// 校验整条链，返回的 error 只表示存储读取失败，链本身的问题都记录在报告里
+func (bc *Blockchain) Verify() (*VerifyReport, error) {
+	report := &VerifyReport{}
+
+	//先检查存储中的每一个键是否等于区块自己的哈希
+	err := bc.scanBlocks(func(key []byte, b *block.Block, err error) error {
+		report.Stored++
+		if err != nil {
+			report.Problems = append(report.Problems, VerifyProblem{Height: -1, Depth: -1, Hash: key, Reason: scanReason(err)})
+			return nil
+		}
+		if !bytes.Equal(key, b.Hash) {
+			report.Problems = append(report.Problems, VerifyProblem{
+				Height: -1, Depth: -1, Hash: key,
+				Reason: fmt.Sprintf("stored under key %x but block hash is %x", key, b.Hash),
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tip, err := bc.store.GetTip()
+	if err != nil {
+		return nil, err
+	}
+	genesis, err := bc.GenesisHash()
+	if err != nil {
+		return nil, err
+	}
+	if tip == nil {
+		report.Problems = append(report.Problems, VerifyProblem{Height: -1, Reason: "no tip stored, the chain is empty"})
+		return report, nil
+	}
+
+	//从 tip 往回走，问题先按距离 tip 的深度记录，走完后再换算成高度
+	var chainProblems []VerifyProblem
+	addProblem := func(depth int, hash []byte, format string, args ...interface{}) {
+		chainProblems = append(chainProblems, VerifyProblem{Depth: depth, Hash: hash, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	seen := make(map[string]bool)
+	now := time.Now()
+	hash := tip
+	var child *block.Block
+	reachedGenesis := false
+	for depth := 0; ; depth++ {
+		if seen[string(hash)] {
+			addProblem(depth, hash, "cycle detected, block already visited")
+			break
+		}
+		seen[string(hash)] = true
+
+		b, err := bc.store.GetBlock(hash)
+		if errors.Is(err, store.ErrBlockNotFound) {
+			if child == nil {
+				addProblem(depth, hash, "tip points to a missing block")
+			} else {
+				addProblem(depth, hash, "missing block, referenced by %x", child.Hash)
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.Blocks++
+
+		if !bytes.Equal(b.Hash, hash) {
+			addProblem(depth, hash, "block stored under this key has hash %x", b.Hash)
+		}
+
+		pruned, err := bc.store.IsPruned(hash)
+		if err != nil {
+			return nil, err
+		}
+		hasBody, err := bc.HasBody(hash)
+		if err != nil {
+			return nil, err
+		}
+		proof := bc.Proof(b)
+		if !hasBody {
+			kind := "pruned"
+			if pruned {
+				report.Pruned++
+			} else {
+				report.Locked++
+				kind = "encrypted"
+			}
+			if !proof.HashMeetsTarget() {
+				addProblem(depth, hash, "%s block hash does not meet the %d target bits", kind, bc.targetBits)
+			}
+		} else {
+			computed := proof.Hash()
+			if !bytes.Equal(computed, b.Hash) {
+				addProblem(depth, hash, "hash does not match block contents, recomputed %x", computed)
+			}
+			if !proof.Validate() {
+				addProblem(depth, hash, "proof of work is invalid for %d target bits", bc.targetBits)
+			}
+		}
+
+		blockTime := time.Unix(b.Timestamp, 0)
+		if blockTime.After(now.Add(maxFutureDrift)) {
+			addProblem(depth, hash, "timestamp %s is in the future", blockTime.Format(time.RFC3339))
+		}
+		if child != nil && child.Timestamp < b.Timestamp {
+			addProblem(depth-1, child.Hash, "timestamp %s is earlier than its parent's %s",
+				time.Unix(child.Timestamp, 0).Format(time.RFC3339), blockTime.Format(time.RFC3339))
+		}
+
+		if len(b.PrevBlockHash) == 0 {
+			//创世块的内容可以由配置文件指定（见 genesis.go），只有没有记录创世块哈希的旧文件才按默认内容检查
+			if len(genesis) == 0 && string(b.Data) != genesisData {
+				addProblem(depth, hash, "chain ends at a block with data %q instead of the genesis block", b.Data)
+			}
+			if len(genesis) != 0 && !bytes.Equal(genesis, hash) {
+				addProblem(depth, hash, "chain ends at a different genesis block than the recorded %x", genesis)
+			}
+			reachedGenesis = true
+			break
+		}
+
+		child = b
+		hash = b.PrevBlockHash
+	}
+
+	for _, p := range chainProblems {
+		p.Height = -1
+		if reachedGenesis {
+			p.Height = report.Blocks - 1 - p.Depth
+		}
+		report.Problems = append(report.Problems, p)
+	}
+	report.Unreachable = report.Stored - report.Blocks
+
+	return report, nil
+}
@@ -0,0 +1,69 @@
+package chain
+
+import (
+	"strings"
+	"testing"
+
+	"test/blockchain-project/004_db_store/store"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, bc *Blockchain, s store.BlockStore)
+		reason string //期望出现的问题，空表示链应当完好
+	}{
+		{"intact", func(t *testing.T, bc *Blockchain, s store.BlockStore) {}, ""},
+		{"tampered data", func(t *testing.T, bc *Blockchain, s store.BlockStore) {
+			tip, _ := s.GetBlock(bc.tip)
+			tip.Data = []byte("forged")
+			if err := s.PutBlock(tip); err != nil {
+				t.Fatal(err)
+			}
+		}, "hash does not match block contents"},
+		{"missing tip", func(t *testing.T, bc *Blockchain, s store.BlockStore) {
+			if err := s.SetTip([]byte("nowhere")); err != nil {
+				t.Fatal(err)
+			}
+		}, "tip points to a missing block"},
+		{"missing parent", func(t *testing.T, bc *Blockchain, s store.BlockStore) {
+			orphan := mustNewBlock(t, bc, "orphan", []byte("nowhere"))
+			if err := s.PutBlock(orphan); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetTip(orphan.Hash); err != nil {
+				t.Fatal(err)
+			}
+		}, "missing block, referenced by"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			bc := newTestChain(t, s)
+			mustAddBlocks(t, bc, "one")
+			mustAddBlocks(t, bc, "two")
+			tt.tamper(t, bc, s)
+
+			report, err := bc.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.reason == "" {
+				if !report.OK() || report.Blocks != 3 {
+					t.Errorf("Verify() = %+v, want 3 blocks and no problems", report)
+				}
+				return
+			}
+			found := false
+			for _, p := range report.Problems {
+				if strings.Contains(p.Reason, tt.reason) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Verify() problems = %v, want one containing %q", report.Problems, tt.reason)
+			}
+		})
+	}
+}
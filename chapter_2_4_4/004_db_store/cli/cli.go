@@ -0,0 +1,864 @@
+package cli
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/chain"
+	"test/blockchain-project/004_db_store/pow"
+	"test/blockchain-project/004_db_store/store"
+)
+
+/*
+增加CLI 命令交互
+*/
+//CLI负责处理命令行参数
+type CLI struct {
+	bc         *chain.Blockchain
+	configFile string            //读取的配置文件，没有时为空，见 config.go
+	sources    map[string]string //每个配置项的来源
+	dataDir    string            //数据目录，-datadir 或 BLOCKCHAIN_DATADIR
+	chain      string            //链的名字，对应数据目录下的 <chain>.db
+	bucket     string            //链文件中区块所在的 bucket
+	cacheSize  int               //区块缓存的容量，0 表示不使用缓存
+	targetBits int               //新建的链使用的难度
+	maxNonce   int               //挖矿时最多尝试的 nonce 个数
+	inShell    bool              //是否在 shell 中执行命令，见 shell.go
+}
+
+// 环境变量，命令行参数没有指定时使用
+const (
+	dataDirEnv    = "BLOCKCHAIN_DATADIR"
+	chainNameEnv  = "BLOCKCHAIN_CHAIN"
+	bucketEnv     = "BLOCKCHAIN_BUCKET"
+	cacheEnv      = "BLOCKCHAIN_CACHE"
+	targetBitsEnv = "BLOCKCHAIN_TARGET_BITS"
+	maxNonceEnv   = "BLOCKCHAIN_MAX_NONCE"
+	passphraseEnv = "BLOCKCHAIN_PASSPHRASE"
+)
+
+// 各个配置项取默认值，配置文件、环境变量和命令行参数在 Run 中覆盖它们
+func New() *CLI {
+	cfg := chain.DefaultConfig()
+	return &CLI{dataDir: cfg.DataDir, chain: cfg.Chain, bucket: cfg.Bucket, cacheSize: cfg.CacheSize, targetBits: cfg.TargetBits,
+		maxNonce: cfg.MaxNonce}
+}
+
+// Run负责解析命令行参数和处理命令，args 为完整的命令行（包括程序名）
+func (cli *CLI) Run(args []string) {
+	cli.validateArgs(args)
+	//全局参数写在子命令前面，例如：db-store -datadir /tmp/chains -chain test printchain
+	globalFlags := flag.NewFlagSet(args[0], flag.ExitOnError)
+	globalFlags.Usage = cli.printUsage
+	globalFlags.StringVar(&cli.configFile, "config", "", fmt.Sprintf("configuration file, defaults to $%s or %s when it exists", configEnv, defaultConfigFile))
+	globalFlags.StringVar(&cli.bucket, "bucket", cli.bucket, "bolt bucket holding the blocks, an existing chain must use the bucket it was created with")
+	globalFlags.IntVar(&cli.cacheSize, "cache", cli.cacheSize, "number of decoded blocks to keep in the LRU cache, 0 disables it")
+	globalFlags.IntVar(&cli.targetBits, "targetbits", cli.targetBits, "difficulty of new chains, must match the difficulty of an existing chain")
+	globalFlags.IntVar(&cli.maxNonce, "maxnonce", cli.maxNonce, "give up mining a block after this many nonces")
+	cli.addChainFlags(globalFlags)
+	err := globalFlags.Parse(args[1:])
+	if err != nil {
+		cli.fail(err)
+	}
+	//命令行上出现过的参数优先于配置文件和环境变量
+	explicit := make(map[string]bool)
+	globalFlags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	err = cli.loadConfig(explicit)
+	if err != nil {
+		cli.fail(err)
+	}
+	args = globalFlags.Args()
+	if len(args) < 1 {
+		cli.printUsage()
+		os.Exit(exitUsage)
+	}
+	if args[0] == "shell" {
+		cli.runShell()
+		return
+	}
+
+	cli.runCommand(args)
+}
+
+// command 是一个子命令：它的名字，以及注册它自己的参数的函数。
+// setup 在 fs 上注册参数，返回参数解析完以后执行命令的函数，执行时先检查参数的组合，再打开区块链（需要的话）并执行
+type command struct {
+	name  string
+	sub   string //第二个词，例如 config show 的 show，没有时为空
+	setup func(cli *CLI, fs *flag.FlagSet) func()
+}
+
+// 所有子命令，shell 中的命令也从这里找
+var commands = []command{
+	{name: "createblockchain", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		genesis := fs.String("genesis", "", "JSON file describing the genesis block and chain parameters")
+		return func() { cli.createBlockchain(*genesis) }
+	}},
+	{name: "addblock", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		//给addblock 添加 -data标志
+		data := fs.String("data", "", "Block data") //？自定义内容
+		parent := fs.String("parent", "", "hex hash of the parent block, mines a fork instead of extending the tip")
+		return func() {
+			if *data == "" {
+				cli.usage(fs)
+			}
+			cli.withChain(func() { cli.addBlock(*data, *parent) })
+		}
+	}},
+	{name: "printchain", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		limit := fs.Int("limit", 0, "print at most LIMIT blocks, 0 prints all")
+		offset := fs.Int("offset", 0, "skip the first OFFSET blocks")
+		reverse := fs.Bool("reverse", false, "print from genesis to the tip instead of from the tip back")
+		since := fs.String("since", "", "only blocks with a timestamp at or after this time (RFC 3339, YYYY-MM-DD or Unix seconds)")
+		until := fs.String("until", "", "only blocks with a timestamp at or before this time")
+		format := fs.String("format", "text", fmt.Sprintf("output format, one of %v", printFormats))
+		follow := fs.Bool("follow", false, "keep running and print blocks as they are appended to the main chain")
+		interval := fs.Duration("interval", defaultFollowInterval, "how often -follow checks the tip")
+		return func() {
+			opts := printOptions{limit: *limit, offset: *offset, reverse: *reverse, format: *format, follow: *follow, interval: *interval}
+			var sinceErr, untilErr error
+			opts.since, sinceErr = parseTime(*since)
+			opts.until, untilErr = parseTime(*until)
+			if err := errors.Join(sinceErr, untilErr); err != nil || opts.limit < 0 || opts.offset < 0 || !slices.Contains(printFormats, opts.format) || opts.interval <= 0 {
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				}
+				cli.usage(fs)
+			}
+			if opts.follow && cli.inShell {
+				fmt.Fprintln(os.Stderr, "error: printchain -follow is not available in the shell, the shell keeps the chain locked")
+				cli.exit(exitUsage)
+			}
+			cli.withChain(func() { cli.printChain(opts) })
+		}
+	}},
+	{name: "getblock", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		hash := fs.String("hash", "", "hex hash of the block, it may be on a side branch")
+		height := fs.Int("height", -1, "height of the block on the main chain")
+		raw := fs.Bool("raw", false, "also print the hex of the serialized block")
+		return func() {
+			if (*hash == "") == (*height < 0) {
+				cli.usage(fs)
+			}
+			cli.withChain(func() { cli.getBlock(*hash, *height, *raw) })
+		}
+	}},
+	{name: "listchains", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		return cli.listChains
+	}},
+	{name: "verifychain", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		return func() { cli.withChain(cli.verifyChain) }
+	}},
+	{name: "repair", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		dryRun := fs.Bool("dry-run", false, "only report what would be repaired, change nothing")
+		return func() { cli.withChain(func() { cli.repair(*dryRun) }) }
+	}},
+	{name: "graph", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		out := fs.String("out", "", "DOT file to write, standard output when empty")
+		return func() { cli.withChain(func() { cli.graph(*out) }) }
+	}},
+	{name: "prune", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		depth := fs.Int("depth", -1, "keep the bodies of the last DEPTH blocks, 0 disables pruning")
+		return func() {
+			if *depth < 0 {
+				cli.usage(fs)
+			}
+			cli.withChain(func() { cli.prune(*depth) })
+		}
+	}},
+	{name: "exportchain", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		out := fs.String("out", "", "snapshot file to write")
+		return func() {
+			if *out == "" {
+				cli.usage(fs)
+			}
+			cli.withChain(func() { cli.exportChain(*out) })
+		}
+	}},
+	{name: "importchain", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		in := fs.String("in", "", "snapshot file to read")
+		return func() {
+			if *in == "" {
+				cli.usage(fs)
+			}
+			cli.importChain(*in)
+		}
+	}},
+	{name: "migrate", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		dryRun := fs.Bool("dry-run", false, "only report the pending migrations, roll back all changes")
+		return func() { cli.migrate(*dryRun) }
+	}},
+	{name: "search", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		query := fs.String("q", "", "words the block data must contain, a trailing * matches a prefix")
+		rebuild := fs.Bool("rebuild", false, "enable the search index and rebuild it from the main chain")
+		drop := fs.Bool("drop", false, "disable the search index and delete it")
+		return func() {
+			if *query == "" && !*rebuild && !*drop {
+				cli.usage(fs)
+			}
+			cli.withChain(func() { cli.search(*query, *rebuild, *drop) })
+		}
+	}},
+	{name: "compress", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		codec := fs.String("codec", "", fmt.Sprintf("block compression, one of %v", store.Codecs))
+		return func() {
+			if *codec == "" {
+				cli.usage(fs)
+			}
+			cli.compress(*codec)
+		}
+	}},
+	{name: "stats", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		asJSON := fs.Bool("json", false, "print the statistics as JSON")
+		return func() { cli.withChain(func() { cli.stats(*asJSON) }) }
+	}},
+	{name: "encrypt", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		return func() { cli.withChain(cli.encrypt) }
+	}},
+	{name: "backup", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		out := fs.String("out", "", "file to write the backup to")
+		return func() {
+			if *out == "" {
+				cli.usage(fs)
+			}
+			cli.withChain(func() { cli.backup(*out) })
+		}
+	}},
+	{name: "restore", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		in := fs.String("in", "", "backup file to restore")
+		return func() {
+			if *in == "" {
+				cli.usage(fs)
+			}
+			cli.restore(*in)
+		}
+	}},
+	{name: "config", sub: "show", setup: func(cli *CLI, fs *flag.FlagSet) func() {
+		return func() {
+			//config show 后面的 -datadir 和 -chain 也是命令行参数
+			cli.markFlagSources(fs)
+			cli.showConfig()
+		}
+	}},
+}
+
+// 执行一个子命令，args[0] 是子命令的名字。shell 中的每一行也由它执行
+func (cli *CLI) runCommand(args []string) {
+	//shell 中参数错误不能退出进程：flag 包打印错误和用法后返回错误，再由 cli.exit 结束这一条命令
+	errorHandling := flag.ExitOnError
+	if cli.inShell {
+		errorHandling = flag.ContinueOnError
+	}
+
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == args[0] })
+	if i < 0 {
+		cli.printUsage()
+		cli.exit(exitUsage)
+	}
+	cmd, rest, name := commands[i], args[1:], args[0]
+	if cmd.sub != "" {
+		if len(rest) < 1 || rest[0] != cmd.sub {
+			cli.printUsage()
+			cli.exit(exitUsage)
+		}
+		rest, name = rest[1:], name+" "+cmd.sub
+	}
+
+	//使用标准库里面的flag包来解析命令行参数：每个子命令有自己的 FlagSet，-datadir 和 -chain 也可以写在子命令后面
+	fs := flag.NewFlagSet(name, errorHandling)
+	run := cmd.setup(cli, fs)
+	cli.addChainFlags(fs)
+	err := fs.Parse(rest)
+	if err != nil {
+		cli.exit(exitUsage)
+	}
+	run()
+}
+
+// 打印子命令的用法并以参数错误退出
+func (cli *CLI) usage(fs *flag.FlagSet) {
+	fs.Usage()
+	cli.exit(exitUsage)
+}
+
+// 打开区块链执行 fn，执行完以后关闭
+func (cli *CLI) withChain(fn func()) {
+	cli.openBlockchain()
+	defer cli.closeBlockchain()
+	fn()
+}
+
+func (cli *CLI) printUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  [-config FILE] [-datadir DIR] [-chain NAME] [-bucket NAME] [-cache BLOCKS] [-targetbits N] [-maxnonce N] COMMAND")
+	fmt.Println("  createblockchain [-genesis FILE] - create a new chain, FILE fixes the genesis data, timestamp, difficulty, hash and chain id")
+	fmt.Println("  addblock -data BLOCK_DATA [-parent HASH] - add a block to the blockchain, or to a fork of it")
+	fmt.Println("  printchain [-limit N] [-offset N] [-reverse] [-since TIME] [-until TIME] [-format text|table|json|csv] [-follow [-interval 2s]] - print the blocks of the main chain")
+	fmt.Println("  getblock -hash HASH | -height HEIGHT [-raw] - print one block with its position, confirmations and size")
+	fmt.Println("  listchains - list the chains stored in the data directory")
+	fmt.Println("  verifychain - check linkage, PoW, hashes, timestamps and genesis of the whole chain")
+	fmt.Println("  repair [-dry-run] - rescan all stored blocks and reset the tip to the longest valid chain from genesis")
+	fmt.Println("  graph [-out FILE] - write every stored block and its parent link as a Graphviz DOT graph")
+	fmt.Println("  prune -depth DEPTH - keep headers of all blocks but only the bodies of the last DEPTH blocks (0 disables)")
+	fmt.Println("  exportchain -out FILE - write the chain from genesis forward to a portable snapshot")
+	fmt.Println("  importchain -in FILE - replay a snapshot into a new chain, validating every block")
+	fmt.Println("  backup -out FILE - write a consistent copy of the chain database while it stays usable")
+	fmt.Println("  restore -in FILE - verify a backup and replace the chain with it, the old file is kept as .old")
+	fmt.Println("  migrate [-dry-run] - upgrade the database to the latest schema version (done automatically on open)")
+	fmt.Println("  compress -codec none|gzip|zstd - compress newly stored blocks and rewrite the existing ones")
+	fmt.Printf("  encrypt - encrypt block bodies with the passphrase in $%s, headers stay readable without it\n", passphraseEnv)
+	fmt.Println("  shell - keep the chain open and read commands from an interactive prompt with history and completion")
+	fmt.Println("  stats [-json] - show block sizes, intervals, nonces and their distribution, and what compression saves")
+	fmt.Println("  config show - print the effective configuration and where each setting comes from")
+	fmt.Println("  search -q QUERY [-rebuild] [-drop] - find main chain blocks whose data contains all words of QUERY (word* matches a prefix)")
+	fmt.Println()
+	fmt.Printf("  settings come from defaults, then the configuration file (-config, $%s or ./%s), then environment variables\n",
+		configEnv, defaultConfigFile)
+	fmt.Printf("  ($%s, $%s, $%s, $%s, $%s, $%s), then flags\n", dataDirEnv, chainNameEnv, bucketEnv, cacheEnv, targetBitsEnv, maxNonceEnv)
+	fmt.Printf("  encrypted chains are unlocked with the passphrase in $%s\n", passphraseEnv)
+	fmt.Println()
+	fmt.Println("Exit codes: 0 ok, 1 failure, 2 usage, 3 chain locked, 4 not found, 5 corrupt data, 6 invalid block or chain, 7 passphrase")
+}
+
+// 进程退出码，脚本可以据此区分失败的原因
+const (
+	exitOK         = 0
+	exitFailure    = 1 //其他错误
+	exitUsage      = 2 //命令行参数错误，与 flag 包解析失败时一致
+	exitLocked     = 3 //链文件被另一个进程打开
+	exitNotFound   = 4 //区块或文件不存在
+	exitCorrupt    = 5 //数据损坏：区块无法解码、文件不是 bolt 数据库、快照格式或校验和错误
+	exitInvalid    = 6 //区块或链无效：工作量证明错误、链接关系错误、全链校验发现问题
+	exitPassphrase = 7 //链已加密但没有口令，或者口令错误
+)
+
+// 把错误映射为退出码
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, store.ErrChainLocked):
+		return exitLocked
+	case errors.Is(err, store.ErrNoPassphrase), errors.Is(err, store.ErrWrongPassphrase):
+		return exitPassphrase
+	case errors.Is(err, block.ErrCorrupt), errors.Is(err, store.ErrCorruptDatabase), errors.Is(err, store.ErrMissingBucket),
+		errors.Is(err, chain.ErrSnapshotFormat), errors.Is(err, chain.ErrSnapshotChecksum), errors.Is(err, chain.ErrNoGenesis):
+		return exitCorrupt
+	case errors.Is(err, pow.ErrInvalid), errors.Is(err, block.ErrInvalid), errors.Is(err, chain.ErrUnknownGenesis),
+		errors.Is(err, chain.ErrBrokenAncestors), errors.Is(err, chain.ErrBackupInvalid), errors.Is(err, chain.ErrBackupOutdated):
+		return exitInvalid
+	case errors.Is(err, chain.ErrInvalidGenesis), errors.Is(err, errInvalidConfig), errors.Is(err, store.ErrInvalidBucket):
+		return exitUsage
+	case errors.Is(err, store.ErrBlockNotFound), errors.Is(err, os.ErrNotExist):
+		return exitNotFound
+	}
+
+	return exitFailure
+}
+
+// 打印可读的错误信息并以对应的退出码退出
+func (cli *CLI) fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	if errors.Is(err, store.ErrNoPassphrase) {
+		fmt.Fprintf(os.Stderr, "set $%s to the passphrase of the chain\n", passphraseEnv)
+	}
+	cli.exit(exitCode(err))
+}
+
+// os.Exit 不会执行 defer，退出前先关闭区块链。shell 中只结束当前这一条命令
+func (cli *CLI) exit(code int) {
+	if cli.inShell {
+		panic(shellExit(code))
+	}
+	if cli.bc != nil {
+		cli.bc.Close()
+	}
+	os.Exit(code)
+}
+
+func (cli *CLI) validateArgs(args []string) {
+	if len(args) < 2 {
+		cli.printUsage()
+		os.Exit(exitUsage)
+	}
+}
+
+// 给一个子命令注册 -datadir 和 -chain，默认值是之前由配置得到的值
+// shell 打开的链是固定的，其中的子命令没有这两个参数
+func (cli *CLI) addChainFlags(fs *flag.FlagSet) {
+	if cli.inShell {
+		return
+	}
+	fs.StringVar(&cli.dataDir, "datadir", cli.dataDir, "directory holding the chain databases")
+	fs.StringVar(&cli.chain, "chain", cli.chain, "name of the chain inside the data directory")
+}
+
+// 由分层的配置得到打开区块链的配置
+func (cli *CLI) config() chain.Config {
+	cfg := chain.DefaultConfig()
+	cfg.DataDir = cli.dataDir
+	cfg.Chain = cli.chain
+	cfg.Bucket = cli.bucket
+	cfg.CacheSize = cli.cacheSize
+	cfg.TargetBits = cli.targetBits
+	cfg.MaxNonce = cli.maxNonce
+	cfg.Passphrase = os.Getenv(passphraseEnv)
+	cfg.Log = os.Stdout
+
+	return cfg
+}
+
+// 打开 -datadir/-chain 指定的区块链，打不开时给出可读的原因并退出。shell 中区块链一直是打开的
+func (cli *CLI) openBlockchain() {
+	if cli.bc != nil {
+		return
+	}
+	var err error
+	cli.bc, err = chain.Open(cli.config())
+	if err != nil {
+		cli.fail(err)
+	}
+	recorded, err := cli.bc.TargetBitsRecorded()
+	if err != nil {
+		cli.fail(err)
+	}
+	tipValid := true
+	if !recorded {
+		info, err := cli.bc.BlockInfo(cli.bc.Tip())
+		if err != nil {
+			cli.fail(err)
+		}
+		tipValid = info.PoWValid
+	}
+	err = cli.checkChainParams(cli.bc.TargetBits(), recorded, tipValid)
+	if err != nil {
+		cli.fail(err)
+	}
+	//addblock -parent 可能引起重组
+	cli.bc.OnReorg(func(e chain.ReorgEvent) {
+		fmt.Printf("Reorganized at fork point %x: %d blocks disconnected, %d connected\n",
+			e.ForkPoint, len(e.Disconnected), len(e.Connected))
+	})
+}
+
+// 命令执行完以后关闭区块链，shell 退出时才关闭。printchain -follow 结束时链已经关闭了
+func (cli *CLI) closeBlockchain() {
+	if cli.inShell || cli.bc == nil {
+		return
+	}
+	cli.bc.Close()
+}
+
+func (cli *CLI) createBlockchain(genesisFile string) {
+	cfg := cli.config()
+	if genesisFile != "" {
+		var err error
+		cfg.Genesis, err = chain.LoadGenesis(genesisFile, cfg.TargetBits)
+		if err != nil {
+			cli.fail(err)
+		}
+		err = cli.checkChainParams(cfg.Genesis.TargetBits, true, true)
+		if err != nil {
+			cli.fail(err)
+		}
+	}
+
+	var err error
+	cli.bc, err = chain.Create(cfg)
+	if err != nil {
+		cli.fail(err)
+	}
+	defer cli.closeBlockchain()
+
+	chainID, err := cli.bc.ChainID()
+	if err != nil {
+		cli.fail(err)
+	}
+	fmt.Printf("Created chain %q with genesis block %x (%d target bits, %s)\n",
+		chainID, cli.bc.Tip(), cli.bc.TargetBits(), cli.bc.HashAlgorithm())
+}
+
+func (cli *CLI) addBlock(data, parent string) {
+	if cli.bc.Encrypted() && os.Getenv(passphraseEnv) == "" {
+		cli.fail(store.ErrNoPassphrase)
+	}
+
+	if parent == "" {
+		_, err := cli.bc.AddBlock(data)
+		if err != nil {
+			cli.fail(err)
+		}
+		fmt.Println("Success!")
+		return
+	}
+
+	parentHash, err := hex.DecodeString(parent)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid -parent: %v\n", err)
+		cli.exit(exitUsage)
+	}
+	b, status, err := cli.bc.AddBlockOn(parentHash, data)
+	if err != nil {
+		cli.fail(err)
+	}
+	fmt.Printf("Block %x stored: %s\n", b.Hash, status)
+}
+
+func (cli *CLI) getBlock(hashHex string, height int, raw bool) {
+	var hash []byte
+	var err error
+	if hashHex != "" {
+		hash, err = hex.DecodeString(hashHex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid -hash: %v\n", err)
+			cli.exit(exitUsage)
+		}
+	} else {
+		hash, err = cli.bc.HashAtHeight(height)
+		if err != nil {
+			cli.fail(fmt.Errorf("height %d: %w", height, err))
+		}
+	}
+
+	info, err := cli.bc.BlockInfo(hash)
+	if err != nil {
+		cli.fail(err)
+	}
+	b := info.Block
+	missing := ""
+	if !info.HasBody {
+		missing = "encrypted"
+		if info.Pruned {
+			missing = "pruned"
+		}
+	}
+
+	fmt.Printf("Hash: %x\n", b.Hash)
+	fmt.Printf("Height: %d\n", info.Height)
+	if info.MainChain {
+		fmt.Printf("Confirmations: %d\n", info.Confirmations)
+	} else {
+		fmt.Println("Confirmations: 0 (side branch)")
+	}
+	fmt.Printf("Timestamp: %d (%s)\n", b.Timestamp, time.Unix(b.Timestamp, 0).Format(time.RFC3339))
+	fmt.Printf("Prev. hash: %x\n", b.PrevBlockHash)
+	if info.Next != nil {
+		fmt.Printf("Next hash: %x\n", info.Next)
+	} else {
+		fmt.Println("Next hash: none")
+	}
+	if len(info.Children) == 0 {
+		fmt.Println("Children: none")
+	} else {
+		fmt.Printf("Children: %d\n", len(info.Children))
+		for _, child := range info.Children {
+			branch := "side branch"
+			if child.MainChain {
+				branch = "main chain"
+			}
+			fmt.Printf("  %x (%s)\n", child.Hash, branch)
+		}
+	}
+	if missing != "" {
+		fmt.Printf("Data: %s\n", missing)
+	} else {
+		fmt.Printf("Data: %s\n", b.Data)
+	}
+	fmt.Printf("Nonce: %d\n", b.Nonce)
+	if missing != "" {
+		fmt.Printf("PoW: %s (body %s, only the hash was checked against %d target bits)\n",
+			strconv.FormatBool(info.PoWValid), missing, cli.bc.TargetBits())
+	} else {
+		fmt.Printf("PoW: %s\n", strconv.FormatBool(info.PoWValid))
+	}
+	if missing != "" {
+		fmt.Printf("Size: %d bytes (without the %s body)\n", len(info.Serialized), missing)
+	} else {
+		fmt.Printf("Size: %d bytes\n", len(info.Serialized))
+	}
+	if raw {
+		fmt.Printf("Raw: %x\n", info.Serialized)
+	}
+}
+
+func (cli *CLI) listChains() {
+	chains, err := store.ListChains(cli.dataDir)
+	if err != nil {
+		cli.fail(err)
+	}
+
+	for _, name := range chains {
+		fmt.Println(name)
+	}
+}
+
+func (cli *CLI) verifyChain() {
+	report, err := cli.bc.Verify()
+	if err != nil {
+		cli.fail(err)
+	}
+
+	for _, p := range report.Problems {
+		fmt.Println(p)
+	}
+	fmt.Printf("Checked %d blocks on the main chain (%d pruned, %d encrypted, headers only), %d stored, %d not on the main chain\n",
+		report.Blocks, report.Pruned, report.Locked, report.Stored, report.Unreachable)
+	if stats, ok := cli.bc.CacheStats(); ok {
+		fmt.Printf("Block cache: %d hits, %d misses, %d evictions, %d/%d blocks cached\n",
+			stats.Hits, stats.Misses, stats.Evictions, stats.Size, stats.Capacity)
+	}
+	if !report.OK() {
+		fmt.Printf("Found %d problems\n", len(report.Problems))
+		cli.exit(exitInvalid)
+	}
+	fmt.Println("Chain is valid")
+}
+
+func (cli *CLI) repair(dryRun bool) {
+	report, err := cli.bc.Repair(dryRun)
+	if err != nil {
+		cli.fail(err)
+	}
+
+	for _, e := range report.Undecodable {
+		fmt.Printf("undecodable %s\n", e)
+	}
+	for _, e := range report.Invalid {
+		fmt.Printf("invalid %s\n", e)
+	}
+	for _, e := range report.Orphaned {
+		fmt.Printf("orphaned %s\n", e)
+	}
+	fmt.Printf("Scanned %d entries: %d reachable from genesis %x, %d undecodable, %d invalid, %d orphaned\n",
+		report.Stored, report.Reachable, report.Genesis, len(report.Undecodable), len(report.Invalid), len(report.Orphaned))
+
+	switch {
+	case !report.Changed:
+		fmt.Printf("Tip %x at height %d is already the longest valid chain, nothing to repair\n", report.NewTip, report.Height)
+	case dryRun:
+		fmt.Printf("Would reset the tip from %x to %x at height %d\n", report.OldTip, report.NewTip, report.Height)
+	default:
+		fmt.Printf("Reset the tip from %x to %x at height %d\n", report.OldTip, report.NewTip, report.Height)
+	}
+}
+
+func (cli *CLI) prune(depth int) {
+	count, err := cli.bc.SetPruneDepth(depth)
+	if err != nil {
+		cli.fail(err)
+	}
+
+	if depth == 0 {
+		fmt.Println("Pruning disabled")
+		return
+	}
+	prunedHeight, err := cli.bc.PrunedHeight()
+	if err != nil {
+		cli.fail(err)
+	}
+	fmt.Printf("Pruned %d block bodies, bodies are kept for the last %d blocks (pruned up to height %d)\n",
+		count, depth, prunedHeight)
+}
+
+func (cli *CLI) exportChain(out string) {
+	f, err := os.Create(out)
+	if err != nil {
+		cli.fail(err)
+	}
+
+	count, err := cli.bc.Export(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out)
+		cli.fail(err)
+	}
+	fmt.Printf("Exported %d blocks to %s\n", count, out)
+}
+
+// 导入只能生成一条新链，目标链文件已经存在时直接拒绝
+func (cli *CLI) importChain(in string) {
+	f, err := os.Open(in)
+	if err != nil {
+		cli.fail(err)
+	}
+	defer f.Close()
+
+	path, err := store.ChainPath(cli.dataDir, cli.chain)
+	if err != nil {
+		cli.fail(err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		cli.fail(fmt.Errorf("%s already exists, import into a new -chain or -datadir", path))
+	}
+
+	s, err := store.NewBoltStore(path, cli.bucket)
+	if err != nil {
+		cli.fail(err)
+	}
+	defer s.Close()
+
+	count, err := chain.Import(s, f, cli.config())
+	if err != nil {
+		s.Close()
+		cli.fail(fmt.Errorf("import stopped after %d valid blocks: %w", count, err))
+	}
+	fmt.Printf("Imported %d blocks into %s\n", count, path)
+}
+
+// 迁移直接作用在 BoltStore 上，不经过 chain.New，否则打开时就已经自动迁移了
+func (cli *CLI) migrate(dryRun bool) {
+	path, err := store.ChainPath(cli.dataDir, cli.chain)
+	if err != nil {
+		cli.fail(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		cli.fail(err)
+	}
+	s, err := store.NewBoltStore(path, cli.bucket)
+	if err != nil {
+		cli.fail(err)
+	}
+	defer s.Close()
+
+	version, err := s.SchemaVersion()
+	if err != nil {
+		cli.fail(err)
+	}
+	fmt.Printf("Schema version %d, latest is %d\n", version, store.LatestSchemaVersion)
+
+	steps, err := s.Migrate(dryRun)
+	for _, m := range steps {
+		if dryRun {
+			fmt.Printf("  would migrate to version %d: %s\n", m.Version, m.Description)
+		} else {
+			fmt.Printf("  migrated to version %d: %s\n", m.Version, m.Description)
+		}
+	}
+	if err != nil {
+		s.Close()
+		cli.fail(err)
+	}
+	if len(steps) == 0 {
+		fmt.Println("Nothing to migrate")
+	}
+}
+
+func (cli *CLI) search(query string, rebuild, drop bool) {
+	if drop {
+		err := cli.bc.DropSearchIndex()
+		if err != nil {
+			cli.fail(err)
+		}
+		fmt.Println("Search index dropped")
+		return
+	}
+	if rebuild {
+		indexed, skipped, err := cli.bc.RebuildSearchIndex()
+		if err != nil {
+			cli.fail(err)
+		}
+		fmt.Printf("Indexed %d blocks", indexed)
+		if skipped > 0 {
+			fmt.Printf(", skipped %d pruned blocks", skipped)
+		}
+		fmt.Println()
+	}
+	if query == "" {
+		return
+	}
+
+	results, err := cli.bc.Search(query)
+	if err == chain.ErrSearchDisabled {
+		err = fmt.Errorf("%w, run: search -rebuild", err)
+	}
+	if err != nil {
+		cli.fail(err)
+	}
+
+	for _, r := range results {
+		fmt.Printf("%x height %d %s\n", r.Hash, r.Height, time.Unix(r.Timestamp, 0).Format(time.RFC3339))
+	}
+	fmt.Printf("%d blocks found\n", len(results))
+}
+
+// 和 migrate 一样直接作用在 BoltStore 上
+func (cli *CLI) compress(codec string) {
+	path, err := store.ChainPath(cli.dataDir, cli.chain)
+	if err != nil {
+		cli.fail(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		cli.fail(err)
+	}
+	s, err := store.NewBoltStore(path, cli.bucket)
+	if err != nil {
+		cli.fail(err)
+	}
+	defer s.Close()
+
+	count, err := s.SetCodec(codec)
+	if err != nil {
+		s.Close()
+		cli.fail(err)
+	}
+	fmt.Printf("Blocks are now stored with codec %s, rewrote %d blocks\n", codec, count)
+}
+
+func (cli *CLI) encrypt() {
+	count, err := cli.bc.EnableEncryption(os.Getenv(passphraseEnv))
+	if err != nil {
+		cli.fail(err)
+	}
+	fmt.Printf("Encrypted %d block bodies, keep $%s safe: without it the bodies cannot be recovered\n", count, passphraseEnv)
+}
+
+func (cli *CLI) backup(out string) {
+	//不覆盖已有的文件
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		cli.fail(err)
+	}
+
+	n, err := cli.bc.Backup(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out)
+		cli.fail(err)
+	}
+	fmt.Printf("Backed up %d bytes to %s\n", n, out)
+}
+
+func (cli *CLI) restore(in string) {
+	path, err := store.ChainPath(cli.dataDir, cli.chain)
+	if err != nil {
+		cli.fail(err)
+	}
+
+	report, err := chain.Restore(in, path, cli.config())
+	if report != nil {
+		for _, p := range report.Problems {
+			fmt.Println(p)
+		}
+	}
+	if errors.Is(err, chain.ErrRestoreIncomplete) {
+		cli.fail(fmt.Errorf("restore of %s failed: %w", path, err)) //错误中说明了链文件现在的位置
+	}
+	if err != nil {
+		cli.fail(fmt.Errorf("restore failed, %s was not changed: %w", path, err))
+	}
+	fmt.Printf("Verified %d blocks, restored %s from %s\n", report.Blocks, path, in)
+}
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/chain"
+	"test/blockchain-project/004_db_store/pow"
+	"test/blockchain-project/004_db_store/store"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, exitOK},
+		{errors.New("something else"), exitFailure},
+		{fmt.Errorf("open: %w", store.ErrChainLocked), exitLocked},
+		{&block.Error{Hash: []byte{1}, Err: store.ErrBlockNotFound}, exitNotFound},
+		{os.ErrNotExist, exitNotFound},
+		{&block.Error{Hash: []byte{1}, Err: fmt.Errorf("%w: bad gob", block.ErrCorrupt)}, exitCorrupt},
+		{store.ErrCorruptDatabase, exitCorrupt},
+		{chain.ErrSnapshotChecksum, exitCorrupt},
+		{fmt.Errorf("block at height 3: %w", pow.ErrInvalid), exitInvalid},
+		{chain.ErrBackupInvalid, exitInvalid},
+		{store.ErrWrongPassphrase, exitPassphrase},
+		{fmt.Errorf("genesis.json: %w", chain.ErrInvalidGenesis), exitUsage},
+	}
+
+	for _, tt := range tests {
+		if code := exitCode(tt.err); code != tt.code {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, code, tt.code)
+		}
+	}
+}
+
+// 用法中列出的命令（shell 除外）都在命令表里，并且能注册自己的参数
+func TestCommands(t *testing.T) {
+	usage := captureStdout(t, New().printUsage)
+	for _, name := range slices.Concat(shellCommands, shellExcluded) {
+		if name == "shell" {
+			continue
+		}
+		if !strings.Contains(usage, "\n  "+name+" ") {
+			t.Errorf("%s is not in the usage", name)
+		}
+		i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+		if i < 0 {
+			t.Errorf("%s is not in the command table", name)
+			continue
+		}
+		cli := New()
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		if commands[i].setup(cli, fs) == nil {
+			t.Errorf("%s: setup returned no function", name)
+		}
+		cli.addChainFlags(fs)
+	}
+}
+
+// 在 shell 模式下执行一条命令，返回它的退出码，没有调用 cli.exit 时为 exitOK
+func runExit(t *testing.T, cli *CLI, args ...string) (code int) {
+	t.Helper()
+	defer func() {
+		switch r := recover().(type) {
+		case nil:
+		case shellExit:
+			code = int(r)
+		default:
+			panic(r)
+		}
+	}()
+	cli.runCommand(args)
+
+	return exitOK
+}
+
+func TestRunCommand(t *testing.T) {
+	cli, _ := newTestCLI(t, 1)
+	cli.inShell = true
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"frobnicate"}, exitUsage},
+		{[]string{"config"}, exitUsage},
+		{[]string{"config", "hide"}, exitUsage},
+		{[]string{"exportchain"}, exitUsage},
+		{[]string{"getblock", "-hash", "00", "-height", "1"}, exitUsage},
+		{[]string{"getblock", "-bogus"}, exitUsage},
+		{[]string{"getblock", "-height", "1"}, exitOK},
+		{[]string{"getblock", "-height", "9"}, exitNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var code int
+			capture(t, &os.Stderr, func() {
+				captureStdout(t, func() { code = runExit(t, cli, tt.args...) })
+			})
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
+
+// 导出失败时删除写了一半的文件
+func TestExportChainFailure(t *testing.T) {
+	cli, _ := newTestCLI(t, 8)
+	cli.inShell = true
+	_, err := cli.bc.SetPruneDepth(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "chain.snapshot")
+
+	var code int
+	capture(t, &os.Stderr, func() { code = runExit(t, cli, "exportchain", "-out", out) })
+	if code == exitOK {
+		t.Error("exporting a pruned chain succeeded")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("%s was left behind: %v", out, err)
+	}
+}
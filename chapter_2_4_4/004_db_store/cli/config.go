@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"test/blockchain-project/004_db_store/chain"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================分层配置===========================================
+/**
+难度、nonce 上限、数据目录、区块所在的 bucket 这些设置以前要么写死在代码里，要么只能用某一种方式指定。现在每个设置都可以来自四个地方，后面的覆盖前面的：
+1.默认值
+2.配置文件：-config 或 $BLOCKCHAIN_CONFIG 指定，都没有时读取当前目录下的 db-store.toml（不存在就跳过）
+3.环境变量，例如 $BLOCKCHAIN_TARGET_BITS
+4.命令行参数，全局参数写在子命令前面，-datadir 和 -chain 也可以写在子命令后面
+配置文件是 TOML 的一个子集：每行一个 key = value，# 开始注释，字符串用引号，整数不用，不支持表（[section]）。
+	datadir = "/var/lib/chains"
+	chain = "team"
+	target_bits = 16
+未知的键、类型不对或者取值不安全时报错，而不是悄悄忽略。难度只对新建的链有意义：
+已有的链使用元数据中记录的难度，明确配置的 target_bits 与它不同时拒绝执行，因为改变难度会让链上所有块的工作量证明失效；
+旧文件没有记录难度，无法比较，明确配置了 target_bits 时同样拒绝执行。
+bucket 默认是原来的 "blocks"，打开、迁移、压缩和恢复链文件都使用配置的 bucket，已有的链必须使用创建它时的 bucket。
+口令只能来自 $BLOCKCHAIN_PASSPHRASE，不要写进配置文件。config show 打印最终生效的配置和每一项的来源。
+*/
+
+const (
+	configEnv         = "BLOCKCHAIN_CONFIG"
+	defaultConfigFile = "db-store.toml"
+)
+
+var errInvalidConfig = errors.New("invalid configuration")
+
+// 配置项的来源为默认值时的说明
+const sourceDefault = "default"
+
+// 一个配置项：配置文件中的键、环境变量、全局参数的名字，以及保存它的 CLI 字段（*string 或 *int）
+type setting struct {
+	key   string
+	env   string
+	flag  string
+	field func(cli *CLI) any
+}
+
+var settings = []setting{
+	{"datadir", dataDirEnv, "datadir", func(cli *CLI) any { return &cli.dataDir }},
+	{"chain", chainNameEnv, "chain", func(cli *CLI) any { return &cli.chain }},
+	{"bucket", bucketEnv, "bucket", func(cli *CLI) any { return &cli.bucket }},
+	{"cache", cacheEnv, "cache", func(cli *CLI) any { return &cli.cacheSize }},
+	{"target_bits", targetBitsEnv, "targetbits", func(cli *CLI) any { return &cli.targetBits }},
+	{"max_nonce", maxNonceEnv, "maxnonce", func(cli *CLI) any { return &cli.maxNonce }},
+}
+
+// 配置文件中的一个值
+type configValue struct {
+	text   string
+	quoted bool //是否是字符串
+	line   int
+}
+
+// 命令行参数已经解析到 CLI 的字段里，explicit 是命令行上出现过的全局参数；
+// 再按 配置文件 < 环境变量 < 命令行参数 的顺序确定其余的配置项，并记录每一项的来源
+func (cli *CLI) loadConfig(explicit map[string]bool) error {
+	path, required := cli.configFile, explicit["config"]
+	if !required {
+		path, required = os.Getenv(configEnv), true
+	}
+	if path == "" {
+		path, required = defaultConfigFile, false
+	}
+	values, err := parseConfigFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		path, values, err = "", nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	cli.configFile = path
+
+	known := make(map[string]bool)
+	for _, s := range settings {
+		known[s.key] = true
+	}
+	for key, v := range values {
+		if !known[key] {
+			return fmt.Errorf("%s:%d: %w: unknown key %q", path, v.line, errInvalidConfig, key)
+		}
+	}
+
+	cli.sources = make(map[string]string)
+	for _, s := range settings {
+		field := s.field(cli)
+		_, isString := field.(*string)
+		v, inFile := values[s.key]
+		env := os.Getenv(s.env)
+		switch {
+		case explicit[s.flag]:
+			cli.sources[s.key] = "flag -" + s.flag
+		case env != "":
+			err = assign(field, env)
+			if err != nil {
+				return fmt.Errorf("$%s: %w: %v", s.env, errInvalidConfig, err)
+			}
+			cli.sources[s.key] = "env $" + s.env
+		case inFile:
+			if v.quoted != isString {
+				kind := "an integer"
+				if isString {
+					kind = "a quoted string"
+				}
+				return fmt.Errorf("%s:%d: %w: %s must be %s", path, v.line, errInvalidConfig, s.key, kind)
+			}
+			err = assign(field, v.text)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w: %s: %v", path, v.line, errInvalidConfig, s.key, err)
+			}
+			cli.sources[s.key] = fmt.Sprintf("%s:%d", path, v.line)
+		default:
+			cli.sources[s.key] = sourceDefault
+		}
+	}
+
+	return cli.validateConfig()
+}
+
+func assign(field any, text string) error {
+	switch f := field.(type) {
+	case *string:
+		*f = text
+	case *int:
+		n, err := strconv.Atoi(strings.ReplaceAll(text, "_", ""))
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", text)
+		}
+		*f = n
+	}
+
+	return nil
+}
+
+// 每一项单独检查取值范围，和链有关的检查见 checkChainParams
+func (cli *CLI) validateConfig() error {
+	invalid := func(key, format string, args ...any) error {
+		return fmt.Errorf("%w: %s (from %s) %s", errInvalidConfig, key, cli.sources[key], fmt.Sprintf(format, args...))
+	}
+	if err := store.CheckBucket(cli.bucket); err != nil {
+		return invalid("bucket", "%q: %v", cli.bucket, err)
+	}
+	switch {
+	case cli.dataDir == "":
+		return invalid("datadir", "is empty")
+	case cli.chain == "":
+		return invalid("chain", "is empty")
+	case cli.cacheSize < 0:
+		return invalid("cache", "is %d, use 0 to disable the cache", cli.cacheSize)
+	case cli.targetBits <= 0 || cli.targetBits >= 256:
+		return invalid("target_bits", "is %d, not between 1 and 255", cli.targetBits)
+	case cli.maxNonce <= 0:
+		return invalid("max_nonce", "is %d, must be positive", cli.maxNonce)
+	}
+
+	return nil
+}
+
+// 明确配置了难度时，它必须和打开的链使用的难度一致，否则挖出的块和已有的块难度不同。
+// 旧文件没有记录难度（recorded 为 false），打开时使用的就是配置的难度，只能用 tip 的工作量证明检查它：
+// 难度也是哈希的输入，用错误的难度校验已有的块一定失败，tipValid 就是 tip 在配置的难度下是否有效
+func (cli *CLI) checkChainParams(targetBits int, recorded, tipValid bool) error {
+	if cli.sources["target_bits"] == sourceDefault {
+		return nil
+	}
+	if !recorded {
+		if tipValid {
+			return nil
+		}
+		return fmt.Errorf("%w: target_bits is %d (from %s) but the blocks of chain %q were not mined with it; the chain does not "+
+			"record its difficulty, set the one it was created with (the default is %d)", errInvalidConfig,
+			cli.targetBits, cli.sources["target_bits"], cli.chain, chain.DefaultConfig().TargetBits)
+	}
+	if targetBits == cli.targetBits {
+		return nil
+	}
+
+	return fmt.Errorf("%w: target_bits is %d (from %s) but chain %q uses %d; changing the difficulty of an existing chain "+
+		"would invalidate its proofs of work, remove the setting or choose another -chain", errInvalidConfig,
+		cli.targetBits, cli.sources["target_bits"], cli.chain, targetBits)
+}
+
+// 打印生效的配置，输出本身也是一个合法的配置文件，来源写在注释里
+func (cli *CLI) showConfig() {
+	configFile := cli.configFile
+	if configFile == "" {
+		configFile = "none"
+	}
+	fmt.Printf("# configuration file: %s\n", configFile)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, s := range settings {
+		var value string
+		switch f := s.field(cli).(type) {
+		case *string:
+			value = strconv.Quote(*f)
+		case *int:
+			value = strconv.Itoa(*f)
+		}
+		fmt.Fprintf(w, "%s = %s\t# %s\n", s.key, value, cli.sources[s.key])
+	}
+	w.Flush()
+
+	passphrase := "not set"
+	if os.Getenv(passphraseEnv) != "" {
+		passphrase = "set"
+	}
+	fmt.Printf("# passphrase: %s in $%s\n", passphrase, passphraseEnv)
+}
+
+//------------------------------------------配置文件------------------------------------------
+
+// 解析 TOML 子集的配置文件，返回键到值的映射
+func parseConfigFile(path string) (map[string]configValue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]configValue)
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNo := i + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("%s:%d: %w: tables are not supported, put every key at the top level", path, lineNo, errInvalidConfig)
+		}
+
+		key, rest, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !isBareKey(key) {
+			return nil, fmt.Errorf("%s:%d: %w: expected key = value", path, lineNo, errInvalidConfig)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("%s:%d: %w: %s is set twice", path, lineNo, errInvalidConfig, key)
+		}
+		v, err := parseConfigValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w: %s: %v", path, lineNo, errInvalidConfig, key, err)
+		}
+		v.line = lineNo
+		values[key] = v
+	}
+
+	return values, nil
+}
+
+// 值可以是 "基本字符串"、'字面字符串' 或者不带引号的整数，后面可以跟注释
+func parseConfigValue(s string) (configValue, error) {
+	var v configValue
+	var rest string
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return v, errors.New("unterminated string")
+		}
+		text, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return v, fmt.Errorf("invalid string %s", s[:end+1])
+		}
+		v.text, v.quoted, rest = text, true, s[end+1:]
+	case strings.HasPrefix(s, "'"):
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return v, errors.New("unterminated string")
+		}
+		v.text, v.quoted, rest = s[1:end+1], true, s[end+2:]
+	default:
+		v.text, _, _ = strings.Cut(s, "#")
+		v.text = strings.TrimSpace(v.text)
+		if v.text == "" {
+			return v, errors.New("missing value")
+		}
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return v, fmt.Errorf("unexpected %q after the value", rest)
+	}
+
+	return v, nil
+}
+
+func isBareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// config show 后面的 -datadir 和 -chain 也是命令行参数
+func (cli *CLI) markFlagSources(fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name {
+				cli.sources[s.key] = "flag -" + f.Name
+			}
+		}
+	})
+}
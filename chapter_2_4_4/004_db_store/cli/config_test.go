@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"test/blockchain-project/004_db_store/chain"
+)
+
+// 写一个临时配置文件，返回它的路径
+func writeConfig(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db-store.toml")
+	err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// 清掉测试环境中可能存在的配置变量。测试在 cli 目录中运行，这里没有默认的 db-store.toml
+func isolateConfig(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{configEnv, dataDirEnv, chainNameEnv, bucketEnv, cacheEnv, targetBitsEnv, maxNonceEnv} {
+		t.Setenv(name, "")
+	}
+}
+
+// 同一个配置项同时来自多个地方时：命令行参数 > 环境变量 > 配置文件 > 默认值
+func TestConfigPrecedence(t *testing.T) {
+	defaults := chain.DefaultConfig()
+
+	tests := []struct {
+		name       string
+		file       string //配置文件中 target_bits 和 chain 的值，空表示不设置
+		env        string
+		flag       string
+		targetBits int
+		chain      string
+		source     string //target_bits 的来源，配置文件用 "file"
+	}{
+		{"default", "", "", "", defaults.TargetBits, defaults.Chain, sourceDefault},
+		{"file", "10", "", "", 10, "c10", "file"},
+		{"env over file", "10", "12", "", 12, "c12", "env $" + targetBitsEnv},
+		{"flag over env and file", "10", "12", "14", 14, "c14", "flag -targetbits"},
+		{"flag over file", "10", "", "14", 14, "c14", "flag -targetbits"},
+		{"env without file", "", "12", "", 12, "c12", "env $" + targetBitsEnv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateConfig(t)
+			cli := New()
+			explicit := make(map[string]bool)
+			if tt.file != "" {
+				cli.configFile = writeConfig(t, "# test", "target_bits = "+tt.file, `chain = "c`+tt.file+`"`)
+				explicit["config"] = true
+			}
+			if tt.env != "" {
+				t.Setenv(targetBitsEnv, tt.env)
+				t.Setenv(chainNameEnv, "c"+tt.env)
+			}
+			//命令行参数已经由 flag 包解析到字段里
+			if tt.flag != "" {
+				cli.targetBits, cli.chain = atoi(t, tt.flag), "c"+tt.flag
+				explicit["targetbits"], explicit["chain"] = true, true
+			}
+
+			err := cli.loadConfig(explicit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cli.targetBits != tt.targetBits || cli.chain != tt.chain {
+				t.Errorf("target_bits = %d, chain = %q, want %d, %q", cli.targetBits, cli.chain, tt.targetBits, tt.chain)
+			}
+			want := tt.source
+			if want == "file" {
+				want = cli.configFile + ":2"
+			}
+			if got := cli.sources["target_bits"]; got != want {
+				t.Errorf("target_bits source = %q, want %q", got, want)
+			}
+			//没有设置的项保持默认值
+			if cli.dataDir != defaults.DataDir || cli.sources["datadir"] != sourceDefault {
+				t.Errorf("datadir = %q from %s, want the default %q", cli.dataDir, cli.sources["datadir"], defaults.DataDir)
+			}
+		})
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string //配置文件的内容，nil 表示没有配置文件
+		env   map[string]string
+	}{
+		{"unknown key", []string{"difficulty = 8"}, nil},
+		{"string for integer", []string{`cache = "10"`}, nil},
+		{"integer for string", []string{"chain = 10"}, nil},
+		{"table", []string{"[chain]"}, nil},
+		{"set twice", []string{"cache = 1", "cache = 2"}, nil},
+		{"target bits out of range", []string{"target_bits = 300"}, nil},
+		{"reserved bucket", []string{`bucket = "meta"`}, nil},
+		{"search index bucket", []string{`bucket = "search"`}, nil},
+		{"empty chain", []string{`chain = ""`}, nil},
+		{"env not an integer", nil, map[string]string{maxNonceEnv: "many"}},
+		{"negative cache from env", nil, map[string]string{cacheEnv: "-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateConfig(t)
+			cli := New()
+			explicit := make(map[string]bool)
+			if tt.lines != nil {
+				cli.configFile = writeConfig(t, tt.lines...)
+				explicit["config"] = true
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			err := cli.loadConfig(explicit)
+			if !errors.Is(err, errInvalidConfig) {
+				t.Errorf("loadConfig error = %v, want errInvalidConfig", err)
+			}
+		})
+	}
+}
+
+// 明确配置的难度要和链使用的难度相同；旧文件没有记录难度，看 tip 在配置的难度下是否有效
+func TestCheckChainParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		chainBits int
+		recorded  bool
+		tipValid  bool
+		wantErr   bool
+	}{
+		{"default setting", sourceDefault, 20, true, true, false},
+		{"default setting on a legacy file", sourceDefault, 12, false, false, false},
+		{"same difficulty", "flag -targetbits", 12, true, true, false},
+		{"other difficulty", "flag -targetbits", 20, true, true, true},
+		{"legacy file mined with it", "flag -targetbits", 12, false, true, false},
+		{"legacy file mined with another", "env $" + targetBitsEnv, 12, false, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := New()
+			cli.targetBits = 12
+			cli.sources = map[string]string{"target_bits": tt.source}
+			err := cli.checkChainParams(tt.chainBits, tt.recorded, tt.tipValid)
+			if (err != nil) != tt.wantErr || err != nil && !errors.Is(err, errInvalidConfig) {
+				t.Errorf("checkChainParams error = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 明确指定的配置文件必须存在，当前目录下默认的 db-store.toml 不存在时跳过
+func TestConfigFileMissing(t *testing.T) {
+	isolateConfig(t)
+	missing := filepath.Join(t.TempDir(), "missing.toml")
+
+	cli := New()
+	cli.configFile = missing
+	err := cli.loadConfig(map[string]bool{"config": true})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("-config %s: error = %v, want ErrNotExist", missing, err)
+	}
+
+	t.Setenv(configEnv, missing)
+	err = New().loadConfig(map[string]bool{})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("$%s=%s: error = %v, want ErrNotExist", configEnv, missing, err)
+	}
+
+	t.Setenv(configEnv, "")
+	cli = New()
+	err = cli.loadConfig(map[string]bool{})
+	if err != nil || cli.configFile != "" {
+		t.Errorf("without a configuration file: error = %v, file %q", err, cli.configFile)
+	}
+}
+
+func atoi(t *testing.T, s string) int {
+	t.Helper()
+	var n int
+	err := assign(&n, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"test/blockchain-project/004_db_store/chain"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================printchain -follow===========================================
+/**
+printchain -follow 打印完以后不退出，而是像 tail -f 一样每隔 -interval 检查一次 tip（键 "l"），
+把主链上新增的块按高度从低到高接着打印出来，直到 Ctrl-C，这样可以看着队友在另一个进程里往链上加块：
+1.BoltDB 同一时间只允许一个进程以读写方式打开文件，所以两次检查之间链文件是关闭的，每次检查时只读地重新打开，读完马上关闭
+2.检查时文件正被别的进程占用（例如 addblock 正在挖矿）就跳过这一次，下一次再看
+3.发生重组时，在标准错误上说明从哪个高度开始被替换，然后从分叉点之后重新打印新的主链
+-limit 和 -offset 只作用于开始时打印的块，-since 和 -until 对新增的块同样有效。
+开始时的块默认从 tip 往回打印，加上 -reverse 时整个输出都是从旧到新的。
+shell 一直打开着链文件，别的进程无法写入，所以 shell 中不能使用 -follow。
+*/
+
+// 默认每隔多久检查一次 tip
+const defaultFollowInterval = 2 * time.Second
+
+// 关闭链文件，每隔 interval 检查一次 tip，打印新增的块，直到收到中断信号
+func (cli *CLI) follow(out *blockWriter, opts printOptions) {
+	tip := cli.bc.Tip()
+	height, err := cli.bc.Height()
+	if err != nil {
+		cli.fail(err)
+	}
+	cli.flushWriter(out)
+	//把文件锁让给别的进程
+	cli.bc.Close()
+	cli.bc = nil
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-interrupt:
+			return
+		case <-ticker.C:
+		}
+		tip, height = cli.poll(out, opts, tip, height)
+	}
+}
+
+// 只读地重新打开链，打印 tip 离开 lastTip 以后主链上新增的块，返回新的 tip 和它的高度
+func (cli *CLI) poll(out *blockWriter, opts printOptions, lastTip []byte, lastHeight int) ([]byte, int) {
+	//只读打开：链文件被删除时不会新建一条链，也不会迁移或者写入任何东西
+	bc, err := chain.OpenReadOnly(cli.config())
+	if errors.Is(err, store.ErrChainLocked) {
+		return lastTip, lastHeight
+	}
+	if err != nil {
+		cli.fail(err)
+	}
+	cli.bc = bc
+	defer func() {
+		bc.Close()
+		cli.bc = nil
+	}()
+
+	tip := bc.Tip()
+	if bytes.Equal(tip, lastTip) {
+		return lastTip, lastHeight
+	}
+	height, err := bc.Height()
+	if err != nil {
+		cli.fail(err)
+	}
+	start, err := cli.forkHeight(lastTip, lastHeight)
+	if err != nil {
+		cli.fail(err)
+	}
+	if start < lastHeight {
+		fmt.Fprintf(os.Stderr, "Reorganized: blocks above height %d were replaced, printing the new main chain from height %d\n", start, start+1)
+	}
+
+	if height > start {
+		for b, err := range bc.Blocks(chain.AtHeight(start+1), chain.TipRef) {
+			if err != nil {
+				cli.fail(err)
+			}
+			start++
+
+			blockTime := time.Unix(b.Timestamp, 0)
+			if (!opts.since.IsZero() && blockTime.Before(opts.since)) || (!opts.until.IsZero() && blockTime.After(opts.until)) {
+				continue
+			}
+			record, err := cli.blockRecord(b, start)
+			if err != nil {
+				cli.fail(err)
+			}
+			err = out.write(record)
+			if err != nil {
+				cli.fail(err)
+			}
+		}
+	}
+	cli.flushWriter(out)
+
+	return tip, height
+}
+
+// 上一次看到的 tip 与现在的主链分叉的高度：从 lastTip 往回找第一个仍在主链上的块
+func (cli *CLI) forkHeight(lastTip []byte, lastHeight int) (int, error) {
+	height := lastHeight
+	for b, err := range cli.bc.Ancestors(lastTip) {
+		if err != nil {
+			return 0, err
+		}
+		hash, err := cli.bc.HashAtHeight(height)
+		if err != nil && !errors.Is(err, store.ErrBlockNotFound) {
+			return 0, err
+		}
+		if bytes.Equal(hash, b.Hash) {
+			return height, nil
+		}
+		height--
+	}
+
+	return -1, nil
+}
+
+func (cli *CLI) flushWriter(out *blockWriter) {
+	err := out.flush()
+	if err != nil {
+		cli.fail(err)
+	}
+}
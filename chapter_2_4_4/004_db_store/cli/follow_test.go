@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"test/blockchain-project/004_db_store/chain"
+)
+
+// 打开 cli 的链文件，在 parent（nil 表示 tip）上依次挖出 data 中的块，然后关闭，模拟另一个进程往链上加块
+func appendBlocks(t *testing.T, cli *CLI, parent []byte, data ...string) []byte {
+	t.Helper()
+	cfg := cli.config()
+	cfg.TargetBits = testTargetBits
+	cfg.Log = nil
+	bc, err := chain.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	if parent == nil {
+		parent = bc.Tip()
+	}
+	for _, d := range data {
+		b, _, err := bc.AddBlockOn(parent, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent = b.Hash
+	}
+
+	return parent
+}
+
+// 每次 poll 打印的块（csv 中的高度和内容）
+func pollRows(t *testing.T, cli *CLI, out *blockWriter, buf *bytes.Buffer, opts printOptions, tip []byte, height int) ([]byte, int, []string) {
+	t.Helper()
+	buf.Reset()
+	tip, height = cli.poll(out, opts, tip, height)
+	rows, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed []string
+	for _, row := range rows {
+		printed = append(printed, row[0]+" "+row[8])
+	}
+
+	return tip, height, printed
+}
+
+// 别的进程追加块、什么也没做、占着链文件以及引起重组时，poll 打印的内容和返回的 tip
+func TestPollFollow(t *testing.T) {
+	cli := New()
+	cli.dataDir, cli.chain = t.TempDir(), "follow"
+	tip := appendBlocks(t, cli, nil, "one", "two")
+	height := 2
+
+	var buf bytes.Buffer
+	out := &blockWriter{format: "csv", w: &buf, csv: csv.NewWriter(&buf)}
+	opts := printOptions{format: "csv"}
+
+	appendBlocks(t, cli, nil, "three", "four")
+	tip, height, printed := pollRows(t, cli, out, &buf, opts, tip, height)
+	if want := []string{"3 three", "4 four"}; height != 4 || strings.Join(printed, ",") != strings.Join(want, ",") {
+		t.Errorf("after appending: height %d, printed %q; want 4, %q", height, printed, want)
+	}
+	if cli.bc != nil {
+		t.Error("poll left the chain open")
+	}
+
+	//tip 没有变化时什么也不打印
+	same, sameHeight, printed := pollRows(t, cli, out, &buf, opts, tip, height)
+	if !bytes.Equal(same, tip) || sameHeight != height || len(printed) != 0 {
+		t.Errorf("unchanged chain: height %d, printed %q", sameHeight, printed)
+	}
+
+	//链文件被别的进程占用时跳过这一次
+	cfg := cli.config()
+	cfg.Log = nil
+	holder, err := chain.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, lockedHeight, printed := pollRows(t, cli, out, &buf, opts, tip, height)
+	holder.Close()
+	if !bytes.Equal(locked, tip) || lockedHeight != height || len(printed) != 0 {
+		t.Errorf("locked chain: height %d, printed %q", lockedHeight, printed)
+	}
+
+	//从高度 2 分出更长的链，重组后从分叉点之后重新打印
+	holder, err = chain.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := holder.HashAtHeight(2)
+	holder.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendBlocks(t, cli, fork, "three'", "four'", "five'")
+	stderr := capture(t, &os.Stderr, func() {
+		tip, height, printed = pollRows(t, cli, out, &buf, opts, tip, height)
+	})
+	if want := []string{"3 three'", "4 four'", "5 five'"}; height != 5 || strings.Join(printed, ",") != strings.Join(want, ",") {
+		t.Errorf("after a reorg: height %d, printed %q; want 5, %q", height, printed, want)
+	}
+	if !strings.Contains(stderr, "blocks above height 2 were replaced") {
+		t.Errorf("stderr = %q, want a reorg notice", stderr)
+	}
+
+	//-since 对新增的块同样有效，tip 照样前进
+	opts.since = time.Now().Add(time.Hour)
+	appendBlocks(t, cli, nil, "six")
+	_, height, printed = pollRows(t, cli, out, &buf, opts, tip, height)
+	if height != 6 || len(printed) != 0 {
+		t.Errorf("with -since in the future: height %d, printed %q; want 6, nothing", height, printed)
+	}
+}
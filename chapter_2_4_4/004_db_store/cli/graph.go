@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"test/blockchain-project/004_db_store/chain"
+)
+
+//==========================================graph 命令===========================================
+/**
+把 chain.Graph 得到的区块图写成 Graphviz 的 DOT 格式，用 dot -Tsvg chain.dot -o chain.svg 就可以画出来。
+节点显示短哈希、高度、区块内容的开头和 PoW 是否有效（块的哈希和存储它的键不同时显示 hash mismatch），连线从父块指向子块，从左到右就是时间的方向：
+1.主链是蓝色，连线加粗，tip 有双层边框
+2.侧链是灰色，孤块是橙色
+3.无效的块用红色边框，无法解码的条目和缺失的块用红色虚线框
+*/
+
+// 节点标签中区块内容最多显示的字符数
+const graphPreviewLength = 24
+
+var nodeColors = map[chain.NodeKind]string{
+	chain.NodeMain:        "lightblue",
+	chain.NodeSide:        "lightgray",
+	chain.NodeOrphan:      "orange",
+	chain.NodeUndecodable: "white",
+	chain.NodeMissing:     "white",
+}
+
+func (cli *CLI) graph(out string) {
+	nodes, err := cli.bc.Graph()
+	if err != nil {
+		cli.fail(err)
+	}
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if out != "" {
+		f, err = os.Create(out)
+		if err != nil {
+			cli.fail(err)
+		}
+		w = f
+	}
+
+	err = writeDOT(w, nodes)
+	if f != nil {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		cli.fail(err)
+	}
+	if out != "" {
+		fmt.Printf("Wrote %d nodes to %s\n", len(nodes), out)
+	}
+}
+
+func writeDOT(w io.Writer, nodes []chain.GraphNode) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph chain {")
+	fmt.Fprintln(out, "  rankdir=LR;")
+	fmt.Fprintln(out, `  node [shape=box, style=filled, fontname="monospace"];`)
+
+	for _, n := range nodes {
+		attrs := []string{
+			fmt.Sprintf("label=%s", dotQuote(nodeLabel(n))),
+			fmt.Sprintf("fillcolor=%s", nodeColors[n.Kind]),
+		}
+		switch {
+		case n.Kind == chain.NodeUndecodable || n.Kind == chain.NodeMissing:
+			attrs = append(attrs, "color=red", `style="filled,dashed"`)
+		case n.Problem != "":
+			attrs = append(attrs, "color=red", "penwidth=2")
+		}
+		if n.Tip {
+			attrs = append(attrs, "peripheries=2")
+		}
+		fmt.Fprintf(out, "  \"%x\" [%s];\n", n.Key, strings.Join(attrs, ", "))
+	}
+
+	for _, n := range nodes {
+		if n.Block == nil || len(n.Block.PrevBlockHash) == 0 {
+			continue
+		}
+		attrs := ""
+		if n.Kind == chain.NodeMain {
+			attrs = " [penwidth=3, color=blue]"
+		}
+		fmt.Fprintf(out, "  \"%x\" -> \"%x\"%s;\n", n.Block.PrevBlockHash, n.Key, attrs)
+	}
+
+	fmt.Fprintln(out, "}")
+
+	return out.Flush()
+}
+
+func nodeLabel(n chain.GraphNode) string {
+	lines := []string{shortHash(fmt.Sprintf("%x", n.Key))}
+	if n.Height >= 0 {
+		lines = append(lines, fmt.Sprintf("height %d", n.Height))
+	}
+
+	switch {
+	case n.Block == nil:
+		lines = append(lines, n.Kind.String())
+	case !n.HasBody:
+		lines = append(lines, "(body not readable)")
+	default:
+		lines = append(lines, preview(string(n.Block.Data), graphPreviewLength))
+	}
+
+	switch {
+	case n.Block == nil:
+	case n.Problem != "" && !bytes.Equal(n.Key, n.Block.Hash):
+		//块存在别的块的键下，这时没有检查工作量证明，不能说它无效
+		lines = append(lines, "hash mismatch")
+	case n.Problem != "":
+		lines = append(lines, "PoW invalid")
+	default:
+		lines = append(lines, "PoW ok")
+	}
+	if n.Kind == chain.NodeSide || n.Kind == chain.NodeOrphan {
+		lines = append(lines, n.Kind.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// DOT 的字符串：反斜杠和双引号要转义，换行写成 \n
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+
+	return `"` + s + `"`
+}
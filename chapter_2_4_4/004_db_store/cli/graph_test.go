@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/chain"
+)
+
+func TestNodeLabel(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+	b := &block.Block{Data: []byte("send 1BTC to Pig"), Hash: key}
+	short := strings.Repeat("ab", shortHashLength/2) //节点中显示的哈希前缀
+
+	tests := []struct {
+		name string
+		node chain.GraphNode
+		want string
+	}{
+		{"main", chain.GraphNode{Key: key, Block: b, Kind: chain.NodeMain, Height: 3, HasBody: true},
+			short + "\nheight 3\nsend 1BTC to Pig\nPoW ok"},
+		{"side", chain.GraphNode{Key: key, Block: b, Kind: chain.NodeSide, Height: 2, HasBody: true},
+			short + "\nheight 2\nsend 1BTC to Pig\nPoW ok\nside"},
+		{"invalid orphan", chain.GraphNode{Key: key, Block: b, Kind: chain.NodeOrphan, Height: -1, HasBody: true, Problem: "bad"},
+			short + "\nsend 1BTC to Pig\nPoW invalid\norphan"},
+		{"hash mismatch", chain.GraphNode{Key: key, Block: &block.Block{Data: b.Data, Hash: []byte{0x01}}, Kind: chain.NodeOrphan, Height: -1,
+			HasBody: true, Problem: "stored under this key but block hash is 01"},
+			short + "\nsend 1BTC to Pig\nhash mismatch\norphan"},
+		{"pruned", chain.GraphNode{Key: key, Block: b, Kind: chain.NodeMain, Height: 1},
+			short + "\nheight 1\n(body not readable)\nPoW ok"},
+		{"missing", chain.GraphNode{Key: key, Kind: chain.NodeMissing, Height: -1, Problem: "referenced but not stored"},
+			short + "\nmissing"},
+		{"long data", chain.GraphNode{Key: key, Block: &block.Block{Data: []byte(strings.Repeat("x", 30))}, Kind: chain.NodeMain, HasBody: true},
+			short + "\nheight 0\n" + strings.Repeat("x", graphPreviewLength-3) + "...\nPoW ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeLabel(tt.node); got != tt.want {
+				t.Errorf("nodeLabel = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	genesis := &block.Block{Data: []byte(`say "hi"`), PrevBlockHash: []byte{}, Hash: []byte{0x01}}
+	main := &block.Block{Data: []byte("main"), PrevBlockHash: []byte{0x01}, Hash: []byte{0x02}}
+	side := &block.Block{Data: []byte("side"), PrevBlockHash: []byte{0x01}, Hash: []byte{0x03}}
+	nodes := []chain.GraphNode{
+		{Key: []byte{0x01}, Block: genesis, Kind: chain.NodeMain, Height: 0, HasBody: true},
+		{Key: []byte{0x02}, Block: main, Kind: chain.NodeMain, Height: 1, HasBody: true, Tip: true},
+		{Key: []byte{0x03}, Block: side, Kind: chain.NodeSide, Height: 1, HasBody: true, Problem: "bad"},
+		{Key: []byte{0x04}, Kind: chain.NodeMissing, Height: -1, Problem: "referenced but not stored"},
+	}
+
+	var buf bytes.Buffer
+	err := writeDOT(&buf, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"digraph chain {\n  rankdir=LR;\n",
+		`"01" [label="01\nheight 0\nsay \"hi\"\nPoW ok", fillcolor=lightblue];`,
+		`"02" [label="02\nheight 1\nmain\nPoW ok", fillcolor=lightblue, peripheries=2];`,
+		`"03" [label="03\nheight 1\nside\nPoW invalid\nside", fillcolor=lightgray, color=red, penwidth=2];`,
+		`"04" [label="04\nmissing", fillcolor=white, color=red, style="filled,dashed"];`,
+		`"01" -> "02" [penwidth=3, color=blue];`,
+		`"01" -> "03";`,
+		"}\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("DOT output does not contain %s:\n%s", want, out)
+		}
+	}
+	//创世块和缺失的块没有指向父块的连线
+	if n := strings.Count(out, "->"); n != 2 {
+		t.Errorf("DOT output has %d edges, want 2", n)
+	}
+}
@@ -0,0 +1,315 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/chain"
+)
+
+//==========================================printchain 的分页与输出格式===========================================
+/**
+printchain 原来把主链上的块从 tip 到创世块全部打印出来，也不打印时间戳。现在支持：
+1.-reverse 从创世块往 tip 打印，-offset 跳过前面的块，-limit 最多打印多少个块
+2.-since 和 -until 只打印时间戳在这个范围内（包含两端）的块，先过滤再分页
+3.-format 选择输出格式：text（原来的格式，加上高度和时间）、table（一块一行）、json 和 csv
+4.-follow 打印完以后继续等待并打印新增的块，见 follow.go
+json 和 csv 是给脚本用的，字段固定为 blockRecord 中的这些，时间同时给出 Unix 秒数和 UTC 的 RFC 3339，
+区块体被裁剪或加密时 data 为空，pow_valid 在 json 中为 null、在 csv 中为空。
+*/
+
+var printFormats = []string{"text", "table", "json", "csv"}
+
+// 表格和图中只显示哈希的前 16 个十六进制字符
+const shortHashLength = 16
+
+// printchain 的参数
+type printOptions struct {
+	limit    int //0 表示不限制
+	offset   int
+	reverse  bool
+	since    time.Time //零值表示不限制
+	until    time.Time
+	format   string
+	follow   bool
+	interval time.Duration //-follow 检查 tip 的间隔
+}
+
+// blockRecord 是 json 和 csv 输出中的一个块，字段名和顺序不要随意修改
+type blockRecord struct {
+	Height    int    `json:"height"`
+	Hash      string `json:"hash"`
+	PrevHash  string `json:"prev_hash"`
+	Timestamp int64  `json:"timestamp"`
+	Time      string `json:"time"`
+	Nonce     int    `json:"nonce"`
+	Body      string `json:"body"` //present、pruned 或 encrypted
+	PoWValid  *bool  `json:"pow_valid"`
+	Data      string `json:"data"`
+}
+
+var csvHeader = []string{"height", "hash", "prev_hash", "timestamp", "time", "nonce", "body", "pow_valid", "data"}
+
+func (r blockRecord) csv() []string {
+	powValid := ""
+	if r.PoWValid != nil {
+		powValid = strconv.FormatBool(*r.PoWValid)
+	}
+
+	return []string{strconv.Itoa(r.Height), r.Hash, r.PrevHash, strconv.FormatInt(r.Timestamp, 10), r.Time,
+		strconv.Itoa(r.Nonce), r.Body, powValid, r.Data}
+}
+
+// 解析 -since 和 -until：RFC 3339、YYYY-MM-DD（本地时间）或者 Unix 秒数
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time, a YYYY-MM-DD date or Unix seconds", value)
+	}
+
+	return t, nil
+}
+
+func (cli *CLI) printChain(opts printOptions) {
+	out := newBlockWriter(os.Stdout, opts.format)
+	cli.printBlocks(out, opts)
+	if opts.follow {
+		cli.follow(out, opts)
+	}
+	cli.closeWriter(out)
+}
+
+// 按 opts 打印主链上已有的块
+func (cli *CLI) printBlocks(out *blockWriter, opts printOptions) {
+	tipHeight, err := cli.bc.Height()
+	if err != nil {
+		cli.fail(err)
+	}
+
+	filtered := !opts.since.IsZero() || !opts.until.IsZero()
+	skip := opts.offset
+	start, end, step := tipHeight, 0, -1
+	if opts.reverse {
+		start, end, step = 0, tipHeight, 1
+	}
+	//没有时间过滤时，偏移量可以直接换算成起始高度，不用读取被跳过的块
+	if !filtered && skip > 0 {
+		if skip > tipHeight {
+			return
+		}
+		start += step * skip
+		skip = 0
+	}
+
+	printed := 0
+	height := start - step
+	for b, err := range cli.bc.Blocks(chain.AtHeight(start), chain.AtHeight(end)) {
+		if err != nil {
+			cli.fail(err)
+		}
+		height += step
+
+		blockTime := time.Unix(b.Timestamp, 0)
+		if (!opts.since.IsZero() && blockTime.Before(opts.since)) || (!opts.until.IsZero() && blockTime.After(opts.until)) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		record, err := cli.blockRecord(b, height)
+		if err != nil {
+			cli.fail(err)
+		}
+		err = out.write(record)
+		if err != nil {
+			cli.fail(err)
+		}
+		printed++
+		if opts.limit > 0 && printed == opts.limit {
+			break
+		}
+	}
+}
+
+func (cli *CLI) closeWriter(out *blockWriter) {
+	err := out.close()
+	if err != nil {
+		cli.fail(err)
+	}
+}
+
+func (cli *CLI) blockRecord(b *block.Block, height int) (blockRecord, error) {
+	record := blockRecord{
+		Height:    height,
+		Hash:      fmt.Sprintf("%x", b.Hash),
+		PrevHash:  fmt.Sprintf("%x", b.PrevBlockHash),
+		Timestamp: b.Timestamp,
+		Time:      time.Unix(b.Timestamp, 0).UTC().Format(time.RFC3339),
+		Nonce:     b.Nonce,
+		Body:      "present",
+	}
+
+	pruned, err := cli.bc.IsPruned(b.Hash)
+	if err != nil {
+		return record, err
+	}
+	hasBody, err := cli.bc.HasBody(b.Hash)
+	if err != nil {
+		return record, err
+	}
+	if !hasBody {
+		record.Body = "encrypted"
+		if pruned {
+			record.Body = "pruned"
+		}
+		return record, nil
+	}
+
+	//存储的哈希也必须是重新计算出来的哈希，否则只是某个满足难度的哈希被安在了这个块上
+	proof := cli.bc.Proof(b)
+	valid := bytes.Equal(proof.Hash(), b.Hash) && proof.Validate()
+	record.PoWValid = &valid
+	record.Data = string(b.Data)
+
+	return record, nil
+}
+
+//------------------------------------------输出格式------------------------------------------
+
+// blockWriter 按 -format 把块逐个写出
+type blockWriter struct {
+	format string
+	w      io.Writer
+	table  *tabwriter.Writer
+	csv    *csv.Writer
+	count  int
+}
+
+func newBlockWriter(w io.Writer, format string) *blockWriter {
+	out := &blockWriter{format: format, w: w}
+	switch format {
+	case "table":
+		out.table = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(out.table, "HEIGHT\tHASH\tTIME\tNONCE\tPOW\tDATA")
+	case "csv":
+		out.csv = csv.NewWriter(w)
+		out.csv.Write(csvHeader)
+	case "json":
+		fmt.Fprint(w, "[")
+	}
+
+	return out
+}
+
+func (out *blockWriter) write(r blockRecord) error {
+	defer func() { out.count++ }()
+
+	switch out.format {
+	case "table":
+		_, err := fmt.Fprintf(out.table, "%d\t%s\t%s\t%d\t%s\t%s\n",
+			r.Height, shortHash(r.Hash), localTime(r.Timestamp), r.Nonce, r.powText(), preview(r.dataText(), 40))
+		return err
+	case "csv":
+		return out.csv.Write(r.csv())
+	case "json":
+		encoded, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		separator := "\n"
+		if out.count > 0 {
+			separator = ",\n"
+		}
+		_, err = fmt.Fprintf(out.w, "%s  %s", separator, encoded)
+		return err
+	}
+
+	_, err := fmt.Fprintf(out.w, "Height: %d\nTimestamp: %s\nPrev. hash: %s\nData: %s\nHash: %s\nPoW: %s\n\n",
+		r.Height, localTime(r.Timestamp), r.PrevHash, r.dataText(), r.Hash, r.powText())
+	return err
+}
+
+// 把缓冲的输出写出去，json 的数组不结束
+func (out *blockWriter) flush() error {
+	switch out.format {
+	case "table":
+		return out.table.Flush()
+	case "csv":
+		out.csv.Flush()
+		return out.csv.Error()
+	}
+
+	return nil
+}
+
+func (out *blockWriter) close() error {
+	switch out.format {
+	case "table", "csv":
+		return out.flush()
+	case "json":
+		end := "\n]\n"
+		if out.count == 0 {
+			end = "]\n"
+		}
+		_, err := fmt.Fprint(out.w, end)
+		return err
+	}
+
+	return nil
+}
+
+// 区块体不可读时显示原因
+func (r blockRecord) dataText() string {
+	if r.PoWValid == nil {
+		return r.Body
+	}
+	return r.Data
+}
+
+func (r blockRecord) powText() string {
+	if r.PoWValid == nil {
+		return r.Body
+	}
+	return strconv.FormatBool(*r.PoWValid)
+}
+
+// 表格和图中显示的哈希前缀，两处保持一样长，方便对照
+func shortHash(hash string) string {
+	return hash[:min(len(hash), shortHashLength)]
+}
+
+// 本地时区的可读时间
+func localTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05 MST")
+}
+
+// 截断过长的内容，换行换成空格，保证表格一块一行
+func preview(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+
+	return string([]rune(s)[:max-3]) + "..."
+}
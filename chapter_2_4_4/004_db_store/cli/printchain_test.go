@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"test/blockchain-project/004_db_store/block"
+	"test/blockchain-project/004_db_store/chain"
+	"test/blockchain-project/004_db_store/store"
+)
+
+// 测试用的难度，挖一个块只需要几十次哈希
+const testTargetBits = 4
+
+// 在 MemoryStore 上建一条创世块之后有 n 个块的链，高度 i 的块比创世块晚 i 小时，返回 CLI 和各高度的时间戳
+func newTestCLI(t *testing.T, n int) (*CLI, []int64) {
+	t.Helper()
+	cfg := chain.DefaultConfig()
+	cfg.TargetBits = testTargetBits
+	bc, err := chain.New(store.NewMemoryStore(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var timestamps []int64
+	for b, err := range bc.Blocks(chain.GenesisRef, chain.GenesisRef) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		timestamps = append(timestamps, b.Timestamp)
+	}
+	for i := 1; i <= n; i++ {
+		b := &block.Block{Timestamp: timestamps[0] + int64(i)*3600, Data: []byte(fmt.Sprintf("block %d", i)), PrevBlockHash: bc.Tip()}
+		if err := bc.Proof(b).Mine(nil); err != nil {
+			t.Fatal(err)
+		}
+		_, err := bc.ProcessBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		timestamps = append(timestamps, b.Timestamp)
+	}
+
+	return &CLI{bc: bc}, timestamps
+}
+
+// 运行 fn，返回它写到标准输出的内容
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	return capture(t, &os.Stdout, fn)
+}
+
+// 运行 fn 时把 *file（os.Stdout 或 os.Stderr）换成一个临时文件，返回写入的内容
+func capture(t *testing.T, file **os.File, fn func()) string {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	saved := *file
+	*file = f
+	defer func() { *file = saved }()
+	fn()
+
+	out, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out)
+}
+
+// 以 json 格式运行 printchain，返回打印出的块
+func printRecords(t *testing.T, cli *CLI, opts printOptions) []blockRecord {
+	t.Helper()
+	opts.format = "json"
+	out := captureStdout(t, func() { cli.printChain(opts) })
+
+	var records []blockRecord
+	err := json.Unmarshal([]byte(out), &records)
+	if err != nil {
+		t.Fatalf("printchain -format json printed invalid json: %v\n%s", err, out)
+	}
+
+	return records
+}
+
+// 先按时间过滤，再跳过 offset 个块，最多打印 limit 个
+func TestPrintChainPaging(t *testing.T) {
+	cli, ts := newTestCLI(t, 5)
+	at := func(height int) time.Time { return time.Unix(ts[height], 0) }
+
+	tests := []struct {
+		name    string
+		opts    printOptions
+		heights []int
+	}{
+		{"all", printOptions{}, []int{5, 4, 3, 2, 1, 0}},
+		{"limit", printOptions{limit: 2}, []int{5, 4}},
+		{"offset", printOptions{offset: 2}, []int{3, 2, 1, 0}},
+		{"offset and limit", printOptions{offset: 1, limit: 3}, []int{4, 3, 2}},
+		{"offset past genesis", printOptions{offset: 6}, nil},
+		{"reverse", printOptions{reverse: true}, []int{0, 1, 2, 3, 4, 5}},
+		{"reverse page", printOptions{reverse: true, offset: 1, limit: 2}, []int{1, 2}},
+		{"since", printOptions{since: at(3)}, []int{5, 4, 3}},
+		{"until", printOptions{until: at(1)}, []int{1, 0}},
+		{"since and until", printOptions{since: at(1), until: at(4)}, []int{4, 3, 2, 1}},
+		{"filtered page", printOptions{since: at(1), until: at(4), offset: 1, limit: 2}, []int{3, 2}},
+		{"filtered reverse", printOptions{since: at(2), reverse: true, limit: 2}, []int{2, 3}},
+		{"nothing in range", printOptions{since: at(5).Add(time.Second)}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var heights []int
+			for _, r := range printRecords(t, cli, tt.opts) {
+				heights = append(heights, r.Height)
+				if r.Height > 0 && r.Data != fmt.Sprintf("block %d", r.Height) {
+					t.Errorf("height %d: data %q", r.Height, r.Data)
+				}
+			}
+			if !slices.Equal(heights, tt.heights) {
+				t.Errorf("printed heights %v, want %v", heights, tt.heights)
+			}
+		})
+	}
+}
+
+func TestPrintChainFormats(t *testing.T) {
+	cli, ts := newTestCLI(t, 2)
+
+	t.Run("json", func(t *testing.T) {
+		records := printRecords(t, cli, printOptions{limit: 1})
+		if len(records) != 1 {
+			t.Fatalf("printed %d records, want 1", len(records))
+		}
+		r := records[0]
+		if r.Height != 2 || r.Timestamp != ts[2] || r.Time != time.Unix(ts[2], 0).UTC().Format(time.RFC3339) ||
+			r.Body != "present" || r.PoWValid == nil || !*r.PoWValid {
+			t.Errorf("record = %+v", r)
+		}
+		if got := captureStdout(t, func() { cli.printChain(printOptions{format: "json", offset: 5}) }); got != "[]\n" {
+			t.Errorf("empty json output = %q, want []", got)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		out := captureStdout(t, func() { cli.printChain(printOptions{format: "csv"}) })
+		rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 4 || !slices.Equal(rows[0], csvHeader) {
+			t.Fatalf("csv = %q, want a header and 3 rows", rows)
+		}
+		if row := rows[1]; row[0] != "2" || row[7] != "true" || row[8] != "block 2" {
+			t.Errorf("tip row = %q", row)
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		out := captureStdout(t, func() { cli.printChain(printOptions{format: "table"}) })
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		if len(lines) != 4 || !strings.HasPrefix(lines[0], "HEIGHT") {
+			t.Fatalf("table = %q, want a header and 3 rows", lines)
+		}
+		fields := strings.Fields(lines[1])
+		if fields[0] != "2" || fields[1] != fmt.Sprintf("%x", cli.bc.Tip())[:shortHashLength] || !strings.Contains(lines[1], "block 2") {
+			t.Errorf("tip row = %q", lines[1])
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		out := captureStdout(t, func() { cli.printChain(printOptions{format: "text", limit: 1}) })
+		for _, want := range []string{"Height: 2\n", "Data: block 2\n", "PoW: true\n"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("text output %q does not contain %q", out, want)
+			}
+		}
+	})
+}
+
+// 存储的哈希和重新计算的哈希不同的块，工作量证明显示为无效，即使存储的哈希满足难度
+func TestBlockRecordHashMismatch(t *testing.T) {
+	cli, _ := newTestCLI(t, 2)
+	var blocks []*block.Block
+	for b, err := range cli.bc.Blocks(chain.GenesisRef, chain.TipRef) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, b)
+	}
+	tip := blocks[2]
+
+	r, err := cli.blockRecord(tip, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.PoWValid == nil || !*r.PoWValid {
+		t.Fatalf("tip: pow_valid = %v, want true", r.PoWValid)
+	}
+
+	//换上创世块的哈希：它满足难度，区块体也在存储里，但不是这个块的哈希
+	tip.Hash = blocks[0].Hash
+	r, err = cli.blockRecord(tip, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.PoWValid == nil || *r.PoWValid {
+		t.Errorf("block with a foreign hash: pow_valid = %v, want false", r.PoWValid)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	date, _ := time.ParseInLocation(time.DateOnly, "2024-03-01", time.Local)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"1700000000", time.Unix(1700000000, 0), false},
+		{"2024-03-01T12:00:00Z", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), false},
+		{"2024-03-01", date, false},
+		{"yesterday", time.Time{}, true},
+		{"2024-13-01", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTime(tt.value)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseTime(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"short", "short"},
+		{"two\nlines", "two lines"},
+		{"  spaced   out  ", "spaced out"},
+		{"0123456789", "0123456789"},
+		{"0123456789a", "0123456..."},
+		{"区块链区块链区块链区块链", "区块链区块链区..."}, //按字符而不是字节截断
+	}
+
+	for _, tt := range tests {
+		if got := preview(tt.s, 10); got != tt.want {
+			t.Errorf("preview(%q, 10) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+//==========================================交互式 shell===========================================
+/**
+每执行一次命令都要重新打开 bolt 文件，而且文件锁让两个命令不能同时运行。
+shell 命令只打开一次区块链，然后在提示符下反复读取命令并执行，直到 exit 或者 Ctrl-D：
+1.除了创建、导入、迁移、压缩和恢复这些要独占链文件的命令，其余子命令都可以直接使用，参数和命令行一样，-datadir 和 -chain 除外
+2.方向键上下翻阅本次会话的历史，Tab 补全命令名和主链上的区块哈希（-hash、-parent 后面或者以十六进制开头的词）
+3.额外的命令：tip 查看 tip 和链的参数，history 列出本次会话输入过的命令，help 列出可用的命令
+标准输入不是终端时（例如从文件重定向），逐行读取命令，没有提示符和补全，可以用来执行脚本。
+命令出错时只打印错误，不会退出 shell。
+*/
+
+// shell 中不能使用的命令：它们要独占或者替换链文件，或者会打开另一条链
+var shellExcluded = []string{"shell", "createblockchain", "importchain", "migrate", "compress", "restore"}
+
+var shellCommands = []string{"addblock", "printchain", "getblock", "listchains", "verifychain", "repair", "graph", "prune",
+	"exportchain", "search", "stats", "encrypt", "backup", "config"}
+
+var shellBuiltins = []string{"help", "tip", "history", "exit", "quit"}
+
+// 补全哈希时最多列出的候选数
+const maxCompletions = 20
+
+// cli.exit 在 shell 中通过 panic 结束当前命令，由 runShellCommand 恢复
+type shellExit int
+
+func (cli *CLI) runShell() {
+	cli.openBlockchain()
+	cli.inShell = true
+	defer cli.bc.Close()
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if !cli.runLine(scanner.Text(), nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		return
+	}
+
+	fmt.Printf("Chain %q opened, type help for the list of commands\n", cli.chain)
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, cli.chain+"> ")
+	terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return cli.complete(terminal, line, pos)
+	}
+
+	var history []string
+	for {
+		//读取命令时终端处于 raw 模式，执行命令时恢复原来的模式，命令的输出不用经过 terminal
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return
+		}
+		line, err := terminal.ReadLine()
+		term.Restore(fd, state)
+		if err == io.EOF {
+			fmt.Println()
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return
+		}
+
+		if strings.TrimSpace(line) != "" {
+			history = append(history, line)
+		}
+		if !cli.runLine(line, history) {
+			return
+		}
+	}
+}
+
+// 执行一行命令，返回 false 表示退出 shell
+func (cli *CLI) runLine(line string, history []string) bool {
+	args, err := splitLine(line)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return true
+	}
+	if len(args) == 0 {
+		return true
+	}
+
+	switch args[0] {
+	case "exit", "quit":
+		return false
+	case "help":
+		cli.shellHelp()
+		return true
+	case "history":
+		for i, h := range history {
+			fmt.Printf("%4d  %s\n", i+1, h)
+		}
+		return true
+	case "tip":
+		cli.shellTip()
+		return true
+	}
+	if slices.Contains(shellExcluded, args[0]) {
+		fmt.Fprintf(os.Stderr, "error: %s is not available in the shell, run it from the command line\n", args[0])
+		return true
+	}
+	if !slices.Contains(shellCommands, args[0]) {
+		fmt.Fprintf(os.Stderr, "error: unknown command %q, type help for the list of commands\n", args[0])
+		return true
+	}
+
+	cli.runShellCommand(args)
+
+	return true
+}
+
+// 执行一个子命令，cli.fail 和参数错误在 shell 中都以 shellExit 结束命令，错误已经打印过了。
+// 其他 panic（例如空指针）说明程序有错误，区块链可能处于不一致的状态，不能吞掉
+func (cli *CLI) runShellCommand(args []string) {
+	defer func() {
+		switch r := recover().(type) {
+		case nil, shellExit:
+		default:
+			panic(r)
+		}
+	}()
+
+	cli.runCommand(args)
+}
+
+func (cli *CLI) shellHelp() {
+	fmt.Println("Commands (same flags as on the command line, without -datadir and -chain):")
+	fmt.Printf("  %s\n", strings.Join(shellCommands, " "))
+	fmt.Println("Shell commands:")
+	fmt.Println("  tip - show the tip, its height and the chain parameters")
+	fmt.Println("  history - list the commands entered in this session")
+	fmt.Println("  help - show this list")
+	fmt.Println("  exit, quit or Ctrl-D - leave the shell")
+	fmt.Println("Tab completes command names and block hashes of the main chain.")
+}
+
+func (cli *CLI) shellTip() {
+	height, err := cli.bc.Height()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return
+	}
+	chainID, err := cli.bc.ChainID()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return
+	}
+	fmt.Printf("Tip: %x\n", cli.bc.Tip())
+	fmt.Printf("Height: %d\n", height)
+	fmt.Printf("Chain: %s (id %q, %d target bits, %s)\n", cli.chain, chainID, cli.bc.TargetBits(), cli.bc.HashAlgorithm())
+}
+
+// Tab 补全：第一个词补全命令名，-hash、-parent 后面或者以十六进制开头的词补全主链上的区块哈希
+func (cli *CLI) complete(terminal *term.Terminal, line string, pos int) (string, int, bool) {
+	before := line[:pos]
+	start := strings.LastIndexAny(before, " \t") + 1
+	word := before[start:]
+	fields := strings.Fields(before[:start])
+
+	var candidates []string
+	switch {
+	case len(fields) == 0:
+		for _, name := range slices.Concat(shellCommands, shellBuiltins) {
+			if strings.HasPrefix(name, word) {
+				candidates = append(candidates, name)
+			}
+		}
+	case fields[len(fields)-1] == "-hash" || fields[len(fields)-1] == "-parent" || (word != "" && isHex(word)):
+		err := cli.bc.ScanMainChain(func(height int, hash []byte) error {
+			if encoded := fmt.Sprintf("%x", hash); strings.HasPrefix(encoded, word) {
+				candidates = append(candidates, encoded)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", 0, false
+		}
+	}
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+
+	completed := candidates[0]
+	if len(candidates) == 1 {
+		completed += " "
+	} else {
+		for _, c := range candidates[1:] {
+			for !strings.HasPrefix(c, completed) {
+				completed = completed[:len(completed)-1]
+			}
+		}
+		//无法再补全时列出候选
+		if completed == word {
+			shown := candidates
+			if len(shown) > maxCompletions {
+				shown = shown[:maxCompletions]
+			}
+			fmt.Fprintf(terminal, "%s\n", strings.Join(shown, "  "))
+			if len(candidates) > maxCompletions {
+				fmt.Fprintf(terminal, "... %d more\n", len(candidates)-maxCompletions)
+			}
+		}
+	}
+
+	return before[:start] + completed + line[pos:], start + len(completed), true
+}
+
+func isHex(s string) bool {
+	return strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// 把一行拆成参数，支持单引号、双引号和反斜杠转义，例如 addblock -data "send 1BTC to Pig"
+func splitLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/term"
+
+	"test/blockchain-project/004_db_store/chain"
+)
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		args    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{"printchain -limit 2", []string{"printchain", "-limit", "2"}, false},
+		{"  tip\t", []string{"tip"}, false},
+		{`addblock -data "send 1BTC to Pig"`, []string{"addblock", "-data", "send 1BTC to Pig"}, false},
+		{`addblock -data 'it''s'`, []string{"addblock", "-data", "its"}, false},
+		{`addblock -data 'a "quoted" word'`, []string{"addblock", "-data", `a "quoted" word`}, false},
+		{`addblock -data a\ b`, []string{"addblock", "-data", "a b"}, false},
+		{`addblock -data ""`, []string{"addblock", "-data", ""}, false},
+		{`search -q "unterminated`, nil, true},
+		{`search -q trailing\`, nil, true},
+	}
+
+	for _, tt := range tests {
+		args, err := splitLine(tt.line)
+		if (err != nil) != tt.wantErr || !slices.Equal(args, tt.args) {
+			t.Errorf("splitLine(%q) = %q, %v; want %q, error %v", tt.line, args, err, tt.args, tt.wantErr)
+		}
+	}
+}
+
+// 每一行命令的结果：是否继续读取下一行，以及标准输出和标准错误中应该出现的内容
+func TestRunLine(t *testing.T) {
+	cli, _ := newTestCLI(t, 2)
+	cli.inShell = true
+	tip := fmt.Sprintf("%x", cli.bc.Tip())
+
+	tests := []struct {
+		line     string
+		next     bool
+		stdout   string
+		stderr   string
+		wantSame bool //命令之后 tip 不变
+	}{
+		{"", true, "", "", true},
+		{"exit", false, "", "", true},
+		{"quit", false, "", "", true},
+		{"help", true, "Shell commands:", "", true},
+		{"tip", true, "Height: 2\n", "", true},
+		{"history", true, "   1  tip\n", "", true},
+		{"getblock -height 1", true, "Data: block 1\n", "", true},
+		{"getblock -hash " + tip, true, "Height: 2\n", "", true},
+		{"printchain -format csv -limit 1", true, "block 2", "", true},
+		{"getblock -height 9", true, "", "error: height 9", true},            //命令失败时只打印错误
+		{"getblock -bogus", true, "", "flag provided but not defined", true}, //参数错误不能退出进程
+		{"getblock", true, "", "Usage of getblock", true},
+		{"frobnicate", true, "", `unknown command "frobnicate"`, true},
+		{"migrate", true, "", "migrate is not available in the shell", true},
+		{"shell", true, "", "shell is not available in the shell", true},
+		{`search -q "unterminated`, true, "", "unterminated quote", true},
+		{`addblock -data "from the shell"`, true, "Success!\n", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			before := cli.bc.Tip()
+			var next bool
+			var stdout string
+			stderr := capture(t, &os.Stderr, func() {
+				stdout = captureStdout(t, func() { next = cli.runLine(tt.line, []string{"tip"}) })
+			})
+			if next != tt.next {
+				t.Errorf("runLine(%q) = %v, want %v", tt.line, next, tt.next)
+			}
+			if !strings.Contains(stdout, tt.stdout) {
+				t.Errorf("stdout %q does not contain %q", stdout, tt.stdout)
+			}
+			if tt.stderr == "" && stderr != "" || !strings.Contains(stderr, tt.stderr) {
+				t.Errorf("stderr = %q, want %q", stderr, tt.stderr)
+			}
+			if same := bytes.Equal(cli.bc.Tip(), before); same != tt.wantSame {
+				t.Errorf("tip unchanged = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+// 程序错误引起的 panic 不能被 shell 吞掉
+func TestRunLineRuntimePanic(t *testing.T) {
+	cli := &CLI{bc: &chain.Blockchain{}, inShell: true} //没有存储的链，读区块时空指针
+	defer func() {
+		r := recover()
+		if _, ok := r.(runtime.Error); !ok {
+			t.Errorf("recover() = %v, want a runtime.Error", r)
+		}
+	}()
+	capture(t, &os.Stderr, func() {
+		captureStdout(t, func() { cli.runLine("getblock -height 1", nil) })
+	})
+}
+
+func TestComplete(t *testing.T) {
+	cli, _ := newTestCLI(t, 3)
+	cli.inShell = true
+	var hashes []string
+	err := cli.bc.ScanMainChain(func(height int, hash []byte) error {
+		hashes = append(hashes, fmt.Sprintf("%x", hash))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := hashes[len(hashes)-1]
+
+	tests := []struct {
+		name string
+		line string
+		want string //补全后的整行，"" 表示无法补全
+	}{
+		{"command", "getb", "getblock "},
+		{"builtin", "hist", "history "},
+		{"common prefix", "p", "pr"}, //printchain 和 prune
+		{"no command", "xyz", ""},
+		{"hash after -hash", "getblock -hash " + tip[:10], "getblock -hash " + tip + " "},
+		{"hash after -parent", "addblock -parent " + tip[:10], "addblock -parent " + tip + " "},
+		{"bare hex word", "getblock -hash x " + tip[:10], "getblock -hash x " + tip + " "},
+		{"unknown hash", "getblock -hash " + strings.Repeat("z", 4), ""},
+		{"plain argument", "search -q bloc", ""},
+	}
+
+	var listed bytes.Buffer
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(""), &listed}, "> ")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, pos, ok := cli.complete(terminal, tt.line, len(tt.line))
+			if tt.want == "" {
+				if ok {
+					t.Errorf("complete(%q) = %q, want no completion", tt.line, line)
+				}
+				return
+			}
+			if !ok || line != tt.want || pos != len(tt.want) {
+				t.Errorf("complete(%q) = %q, %d, %v; want %q", tt.line, line, pos, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"test/blockchain-project/004_db_store/chain"
+	"test/blockchain-project/004_db_store/store"
+)
+
+//==========================================stats 命令===========================================
+/**
+stats 先打印主链的统计（chain.Stats），再打印存储的统计：压缩节省的空间和区块缓存的命中情况。
+-json 时输出一个对象：chain 为 chain.ChainStats，storage 和 cache 在存储不支持时为 null。
+*/
+
+// 直方图中最长的一条
+const histogramWidth = 40
+
+// stats -json 输出的对象
+type statsRecord struct {
+	Chain   *chain.ChainStats `json:"chain"`
+	Storage *storageRecord    `json:"storage"`
+	Cache   *cacheRecord      `json:"cache"`
+}
+
+type storageRecord struct {
+	Codec       string         `json:"codec"`
+	Blocks      int            `json:"blocks"`
+	ByCodec     map[string]int `json:"by_codec"`
+	RawBytes    int64          `json:"raw_bytes"`
+	StoredBytes int64          `json:"stored_bytes"`
+	FileSize    int64          `json:"file_size"`
+}
+
+type cacheRecord struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+}
+
+func (cli *CLI) stats(asJSON bool) {
+	chainStats, err := cli.bc.Stats()
+	if err != nil {
+		cli.fail(err)
+	}
+	storageStats, hasStorage, err := cli.bc.StorageStats()
+	if err != nil {
+		cli.fail(err)
+	}
+	cacheStats, hasCache := cli.bc.CacheStats()
+
+	if asJSON {
+		record := statsRecord{Chain: chainStats}
+		if hasStorage {
+			record.Storage = &storageRecord{storageStats.Codec, storageStats.Blocks, storageStats.ByCodec,
+				storageStats.RawBytes, storageStats.StoredBytes, storageStats.FileSize}
+		}
+		if hasCache {
+			record.Cache = &cacheRecord{cacheStats.Hits, cacheStats.Misses, cacheStats.Evictions, cacheStats.Size, cacheStats.Capacity}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(record)
+		if err != nil {
+			cli.fail(err)
+		}
+		return
+	}
+
+	fmt.Printf("Blocks: %d (height %d)", chainStats.Blocks, chainStats.Height)
+	if chainStats.HeadersOnly > 0 {
+		fmt.Printf(", %d pruned or encrypted counted by header only", chainStats.HeadersOnly)
+	}
+	fmt.Println()
+	fmt.Printf("Block size: %d bytes in total, average %.1f, min %d, max %d\n",
+		chainStats.Size.Total, chainStats.Size.Average, chainStats.Size.Min, chainStats.Size.Max)
+	if chainStats.Blocks > 1 {
+		fmt.Printf("Block interval: average %.1fs, min %ds, max %ds\n",
+			chainStats.Interval.Average, chainStats.Interval.Min, chainStats.Interval.Max)
+	}
+	fmt.Printf("Nonce: average %.1f, min %d, max %d\n", chainStats.Nonce.Average, chainStats.Nonce.Min, chainStats.Nonce.Max)
+	fmt.Printf("Difficulty: %d target bits with %s, about %.0f hashes per block expected\n",
+		chainStats.TargetBits, chainStats.HashAlgorithm, chainStats.ExpectedHashes)
+
+	printHistogram("Block size (bytes)", chainStats.Size.Histogram)
+	printHistogram("Block interval (seconds)", chainStats.Interval.Histogram)
+	printHistogram("Nonce", chainStats.Nonce.Histogram)
+
+	if hasStorage {
+		fmt.Println()
+		fmt.Printf("Codec: %s\n", storageStats.Codec)
+		fmt.Printf("Stored blocks: %d", storageStats.Blocks)
+		for _, codec := range store.Codecs {
+			if n := storageStats.ByCodec[codec]; n > 0 {
+				fmt.Printf(", %s %d", codec, n)
+			}
+		}
+		fmt.Println()
+		fmt.Printf("Block bytes: %d uncompressed, %d stored, %d saved (%.1f%%)\n",
+			storageStats.RawBytes, storageStats.StoredBytes, storageStats.Saved(), storageStats.SavedPercent())
+		fmt.Printf("File size: %d bytes\n", storageStats.FileSize)
+	}
+	if hasCache {
+		fmt.Printf("Block cache: %d hits, %d misses, %d evictions, %d/%d blocks cached\n",
+			cacheStats.Hits, cacheStats.Misses, cacheStats.Evictions, cacheStats.Size, cacheStats.Capacity)
+	}
+}
+
+func printHistogram(title string, buckets []chain.HistogramBucket) {
+	if len(buckets) == 0 {
+		return
+	}
+	largest := 0
+	for _, b := range buckets {
+		largest = max(largest, b.Count)
+	}
+
+	fmt.Println()
+	fmt.Printf("%s:\n", title)
+	for _, b := range buckets {
+		bar := (b.Count*histogramWidth + largest - 1) / largest
+		fmt.Printf("  %-26s %6d %s\n", fmt.Sprintf("[%d, %d)", b.Min, b.Max), b.Count, strings.Repeat("#", bar))
+	}
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"test/blockchain-project/004_db_store/chain"
+)
+
+func TestStatsOutput(t *testing.T) {
+	cli, _ := newTestCLI(t, 3) //相邻两块间隔一小时
+
+	t.Run("json", func(t *testing.T) {
+		out := captureStdout(t, func() { cli.stats(true) })
+		var record statsRecord
+		err := json.Unmarshal([]byte(out), &record)
+		if err != nil {
+			t.Fatalf("stats -json printed invalid json: %v\n%s", err, out)
+		}
+		if record.Chain == nil || record.Chain.Blocks != 4 || record.Chain.Interval.Average != 3600 {
+			t.Errorf("chain = %+v", record.Chain)
+		}
+		//MemoryStore 既没有压缩统计也没有缓存
+		if record.Storage != nil || record.Cache != nil {
+			t.Errorf("storage = %+v, cache = %+v, want both null", record.Storage, record.Cache)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		out := captureStdout(t, func() { cli.stats(false) })
+		for _, want := range []string{
+			"Blocks: 4 (height 3)\n",
+			"Block interval: average 3600.0s, min 3600s, max 3600s\n",
+			"Block interval (seconds):\n  [2048, 4096)                    3 " + strings.Repeat("#", histogramWidth) + "\n",
+			"Nonce:\n",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("stats output does not contain %q:\n%s", want, out)
+			}
+		}
+		if strings.Contains(out, "Codec:") || strings.Contains(out, "Block cache:") {
+			t.Errorf("stats printed storage statistics for a memory chain:\n%s", out)
+		}
+	})
+}
+
+func TestPrintHistogramBars(t *testing.T) {
+	buckets := []chain.HistogramBucket{{Min: 0, Max: 1, Count: 1}, {Min: 1, Max: 2, Count: 0}, {Min: 2, Max: 4, Count: 80}}
+	out := captureStdout(t, func() { printHistogram("Nonce", buckets) })
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("histogram = %q, want a title and 3 rows", lines)
+	}
+	//最大的桶占满宽度，非空的桶至少有一格
+	for i, want := range []int{1, 0, histogramWidth} {
+		if got := strings.Count(lines[i+1], "#"); got != want {
+			t.Errorf("row %d: %d #, want %d", i, got, want)
+		}
+	}
+	if out := captureStdout(t, func() { printHistogram("empty", nil) }); out != "" {
+		t.Errorf("empty histogram printed %q", out)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	"test/blockchain-project/004_db_store/cli"
+)
+
+//==========================================包的划分===========================================
+/**
+原来所有代码都在 package main 里，别的服务无法导入 Blockchain、ProofOfWork 或者迭代器。现在按职责拆成几个包：
+1.block：区块的数据结构、序列化以及和区块有关的错误
+2.pow：工作量证明，难度由调用者传入
+3.store：存储后端（BoltDB、内存、LRU 缓存）、压缩、加密、迁移和链文件的位置
+4.chain：区块链本身，包括分叉与重组、索引、迭代、裁剪、搜索、校验、导出导入、备份恢复，用 chain.Config 打开
+5.cli：命令行，把配置文件、环境变量和参数变成 chain.Config
+这里的 main 只负责把命令行交给 cli。
+*/
+
+func main() {
+	cli.New().Run(os.Args)
+}
+
+/**
+可以看到每个哈希都是 3 个字节的 0 开始，并且获得这些哈希需要花费一些时间，这次我们产生三个块花费了一分多钟，比没有工作量证明之前慢了很多（也就是成本高了很多）。
+
+我们离真正的区块链又进了一步：现在需要经过一些困难的工作才能加入新的块，因此挖矿就有可能了。但是，它仍然缺少一些至关重要的特性：区块链数据库并不是持久化的，没有钱包，地址，交易，也没有共识机制。不过，所有的这些，我们都会在接下来的文章中实现，现在，愉快地挖矿吧！
+*/
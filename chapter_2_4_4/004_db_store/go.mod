@@ -1,8 +1,12 @@
 module test/blockchain-project/004_db_store
 
-go 1.17
+go 1.23.0
 
 require (
-	github.com/boltdb/bolt v1.3.1 // indirect
-	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
+	github.com/klauspost/compress v1.17.11
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/crypto v0.36.0
+	golang.org/x/term v0.30.0
 )
+
+require golang.org/x/sys v0.31.0 // indirect
@@ -0,0 +1,221 @@
+package pow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+
+	"golang.org/x/crypto/sha3"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+//=========================================工作量证明（Proof-of-Work）================================
+/**
+我们构造了一个非常简单的数据结构 – 区块，它也是整个区块链数据库的核心。目前所完成的区块链原型，已经可以通过链式关系把区块相互关联起来：每个块都与前一个块相关联。
+但是，当前实现的区块链有一个巨大的缺陷：向链中加入区块太容易，也太廉价了。而区块链和比特币的其中一个核心就是，要想加入新的区块，必须先完成一些非常困难的工作。在本文，我们将会弥补这个缺陷。
+区块链的一个关键点就是，一个人必须经过一系列困难的工作，才能将数据放入到区块链中。正是由于这种困难的工作，才保证了区块链的安全和一致。此外，完成这个工作的人，也会获得相应奖励（这也就是通过挖矿获得币）。
+这个机制与生活现象非常类似：一个人必须通过努力工作，才能够获得回报或者奖励，用以支撑他们的生活。在区块链中，是通过网络中的参与者（矿工）不断的工作来支撑起了整个网络。矿工不断地向区块链中加入新块，然后获得相应的奖励。在这种机制的作用下，新生成的区块能够被安全地加入到区块链中，它维护了整个区块链数据库的稳定性。值得注意的是，完成了这个工作的人必须要证明这一点，即他必须要证明他的确完成了这些工作。
+整个 “努力工作并进行证明” 的机制，就叫做工作量证明（proof-of-work）。要想完成工作非常地不容易，因为这需要大量的计算能力：即便是高性能计算机，也无法在短时间内快速完成。另外，这个工作的困难度会随着时间不断增长，以保持每 10 分钟出 1 个新块的速度。在比特币中，这个工作就是找到一个块的哈希，同时这个哈希满足了一些必要条件。这个哈希，也就充当了证明的角色。因此，寻求证明（寻找有效哈希），就是矿工实际要做的事情。
+*/
+
+/**
+哈希计算
+获得指定数据的一个哈希值的过程，就叫做哈希计算。一个哈希，就是对所计算数据的一个唯一表示。对于一个哈希函数，输入任意大小的数据，它会输出一个固定大小的哈希值。下面是哈希的几个关键特性：
+1.无法从一个哈希值恢复原始数据。也就是说，哈希并不是加密。
+2.对于特定的数据，只能有一个哈希，并且这个哈希是唯一的。
+3.即使是仅仅改变输入数据中的一个字节，也会导致输出一个完全不同的哈希
+在区块链中，哈希被用于保证一个块的一致性。哈希算法的输入数据包含了前一个块的哈希，因此使得不太可能（或者，至少很困难）去修改链中的一个块：因为如果一个人想要修改前面一个块的哈希，那么他必须要重新计算这个块以及后面所有块的哈希。
+
+*/
+
+/**
+Hashcash
+比特币使用 Hashcash ，一个最初用来防止垃圾邮件的工作量证明算法。它可以被分解为以下步骤：
+
+1.取一些公开的数据（比如，如果是 email 的话，它可以是接收者的邮件地址；在比特币中，它是区块头）
+2.给这个公开数据添加一个计数器。计数器默认从 0 开始
+3.将 data(数据) 和 counter(计数器) 组合到一起，获得一个哈希
+4.检查哈希是否符合一定的条件：
+1.如果符合条件，结束
+2.如果不符合，增加计数器，重复步骤 3-4
+ca07ca 是计数器的 16 进制值，十进制的话是 13240266.
+*/
+
+// 默认的挖矿难度，以下表示哈希的前 8 位必须是 0
+const DefaultTargetBits = 8
+
+/**
+在比特币中，当一个块被挖出来以后，“target bits” 代表了区块头里存储的难度，也就是开头有多少个 0。这里的 24 指的是算出来的哈希前 24 位必须是 0，如果用 16 进制表示，就是前 6 位必须是 0，这一点从最后的输出可以看出来。目前我们并不会实现一个动态调整目标的算法，所以难度由调用者传入，默认是 DefaultTargetBits。
+24 其实是一个可以任意取的数字，其目的只是为了有一个目标（target）而已，这个目标占据不到 256 位的内存空间。同时，我们想要有足够的差异性，但是又不至于大的过分，因为差异性越大，就越难找到一个合适的哈希
+*/
+
+// 区块的哈希不是由它自己的内容算出来的，或者没有达到难度目标
+var ErrInvalid = errors.New("invalid proof of work")
+
+// 难度不在 1 到 255 之间：0 时任何哈希都满足目标，256 以上时目标移位溢出
+var ErrTargetBits = errors.New("target bits out of range")
+
+// 检查难度是否在 1 到 255 之间，New 和 NewWithHash 不检查，调用者要先用它检查来自配置或文件的难度
+func CheckTargetBits(targetBits int) error {
+	if targetBits <= 0 || targetBits >= 256 {
+		return fmt.Errorf("%w: %d is not between 1 and 255", ErrTargetBits, targetBits)
+	}
+
+	return nil
+}
+
+// 挖矿时默认最多尝试的 nonce 个数，也就是不限制
+const DefaultMaxNonce = math.MaxInt64
+
+// 尝试了 maxNonce 个 nonce 仍然没有找到小于目标的哈希
+var ErrNonceExhausted = errors.New("no valid nonce found")
+
+//------------------------------------------哈希算法------------------------------------------
+
+// 默认的哈希算法，和原来一样是 SHA-256
+const DefaultHash = "sha256"
+
+// 可以选择的哈希算法，sha256d 是比特币使用的两次 SHA-256。一条链的哈希算法在创建时确定，之后不能再改
+var Hashes = []string{"sha256", "sha256d", "sha3-256"}
+
+var ErrUnknownHash = errors.New("unknown hash algorithm")
+
+// HashFunc 把挖矿数据变成 32 字节的哈希
+type HashFunc func(data []byte) [32]byte
+
+// 按名字找到哈希算法
+func LookupHash(name string) (HashFunc, error) {
+	switch name {
+	case "sha256":
+		return sha256.Sum256, nil
+	case "sha256d":
+		return func(data []byte) [32]byte {
+			first := sha256.Sum256(data)
+			return sha256.Sum256(first[:])
+		}, nil
+	case "sha3-256":
+		return sha3.Sum256, nil
+	}
+
+	return nil, fmt.Errorf("%w %q, expected one of %v", ErrUnknownHash, name, Hashes)
+}
+
+// 每个块的工作量都必须要证明，所以有个指向Block的指针
+// target是目标，我们最终要找的哈希必须要小于目标
+type ProofOfWork struct {
+	block      *block.Block
+	target     *big.Int
+	targetBits int
+	hash       HashFunc
+	maxNonce   int //最多尝试的 nonce 个数
+}
+
+// target等于1左移256-targetBits 位？
+func New(b *block.Block, targetBits int) *ProofOfWork {
+	return NewWithHash(b, targetBits, sha256.Sum256)
+}
+
+// 使用指定哈希算法（见 LookupHash）的工作量证明，targetBits 必须已经通过 CheckTargetBits 检查
+func NewWithHash(b *block.Block, targetBits int, hash HashFunc) *ProofOfWork {
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-targetBits))
+	pow := &ProofOfWork{b, target, targetBits, hash, DefaultMaxNonce}
+	return pow
+}
+
+// 限制挖矿时尝试的 nonce 个数，n 不大于 0 时不限制
+func (pow *ProofOfWork) SetMaxNonce(n int) {
+	if n <= 0 {
+		n = DefaultMaxNonce
+	}
+	pow.maxNonce = n
+}
+
+// 工作量证明需要用到的数据有：PrevBlockHash, Data, Timestamp, targetBits, nonce(计数器，密码学术语)
+func (pow *ProofOfWork) prepareData(nonce int) []byte { //这个方法用来准备数据，也可以用来验证工作量
+	data := bytes.Join(
+		[][]byte{
+			pow.block.PrevBlockHash,
+			pow.block.Data,
+			block.IntToHex(pow.block.Timestamp),
+			block.IntToHex(int64(pow.targetBits)),
+			block.IntToHex(int64(nonce)),
+		},
+		[]byte{},
+	)
+
+	return data
+}
+
+// Pow算法的核心就是寻找有效哈希，挖矿的进度写到 out，out 为 nil 时不输出
+func (pow *ProofOfWork) Run(out io.Writer) (int, []byte) {
+	if out == nil {
+		out = io.Discard
+	}
+	var hashInt big.Int //hashInt是hash的整形表示
+	var hash [32]byte
+	nonce := 0 //计数器
+
+	fmt.Fprintf(out, "Mining the block containing \"%s\"\n", pow.block.Data)
+	for nonce < pow.maxNonce { //防止溢出的“无限”循环
+		data := pow.prepareData(nonce) //准备数据
+		hash = pow.hash(data)          //对数据进行哈希计算
+		hashInt.SetBytes(hash[:])      //将将哈希转换成一个大整数
+
+		if hashInt.Cmp(pow.target) == -1 { //将大整数与目标进行比较
+			fmt.Fprintf(out, "\r%x", hash)
+			break
+		} else {
+			nonce++
+		}
+	}
+	fmt.Fprint(out, "\n\n")
+
+	return nonce, hash[:]
+}
+
+// 挖出区块的 Nonce 和 Hash，尝试完全部 nonce 还没找到时返回 ErrNonceExhausted
+func (pow *ProofOfWork) Mine(out io.Writer) error {
+	nonce, hash := pow.Run(out) //调用计算哈希的方法
+	if nonce == pow.maxNonce {
+		return fmt.Errorf("%w in %d attempts at %d target bits", ErrNonceExhausted, pow.maxNonce, pow.targetBits)
+	}
+
+	pow.block.Hash = hash[:]
+	pow.block.Nonce = nonce
+
+	return nil
+}
+
+// 按区块中记录的 Nonce 重新计算哈希
+func (pow *ProofOfWork) Hash() []byte {
+	hash := pow.hash(pow.prepareData(pow.block.Nonce))
+
+	return hash[:]
+}
+
+// 区块体被裁剪后无法重新计算哈希，只能检查区块头中的哈希是否小于目标
+func (pow *ProofOfWork) HashMeetsTarget() bool {
+	var hashInt big.Int
+	hashInt.SetBytes(pow.block.Hash)
+
+	return hashInt.Cmp(pow.target) == -1
+}
+
+// 验证工作量，只要哈希小于目标就是有效工作量
+func (pow *ProofOfWork) Validate() bool {
+	var hashInt big.Int
+
+	data := pow.prepareData(pow.block.Nonce)
+	hash := pow.hash(data)
+	hashInt.SetBytes(hash[:])
+
+	isValid := hashInt.Cmp(pow.target) == -1
+
+	return isValid
+}
@@ -0,0 +1,183 @@
+package pow
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+// 测试用的难度，挖一个块只需要几十次哈希
+const testTargetBits = 4
+
+func newTestBlock(data string) *block.Block {
+	return &block.Block{Timestamp: 1700000000, Data: []byte(data), PrevBlockHash: []byte{}, Hash: []byte{}}
+}
+
+func TestMineAndValidate(t *testing.T) {
+	for _, name := range Hashes {
+		t.Run(name, func(t *testing.T) {
+			hash, err := LookupHash(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := newTestBlock("mined with " + name)
+			proof := NewWithHash(b, testTargetBits, hash)
+			err = proof.Mine(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !proof.Validate() {
+				t.Error("Validate() = false for a mined block")
+			}
+			if !proof.HashMeetsTarget() {
+				t.Error("HashMeetsTarget() = false for a mined block")
+			}
+			if got := proof.Hash(); !bytes.Equal(got, b.Hash) {
+				t.Errorf("Hash() = %x, want the mined hash %x", got, b.Hash)
+			}
+		})
+	}
+}
+
+// 挖出的块被改动以后，Validate 重新计算哈希就能发现；HashMeetsTarget 只看区块头中的哈希
+func TestValidateTampered(t *testing.T) {
+	tests := []struct {
+		name               string
+		tamper             func(b *block.Block)
+		valid, meetsTarget bool
+	}{
+		{"untouched", func(b *block.Block) {}, true, true},
+		{"data", func(b *block.Block) { b.Data = []byte("send 1000BTC to Pig") }, false, true},
+		{"nonce", func(b *block.Block) { b.Nonce++ }, false, true},
+		{"timestamp", func(b *block.Block) { b.Timestamp++ }, false, true},
+		{"hash", func(b *block.Block) { b.Hash = make([]byte, 32); b.Hash[0] = 0xff }, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//低难度下改动后的块仍有可能碰巧满足目标，用较高的难度挖一次，改动后几乎不可能仍然有效
+			b := newTestBlock("send 1BTC to Pig")
+			err := New(b, 12).Mine(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(b)
+
+			proof := New(b, 12)
+			if got := proof.Validate(); got != tt.valid {
+				t.Errorf("Validate() = %v, want %v", got, tt.valid)
+			}
+			if got := proof.HashMeetsTarget(); got != tt.meetsTarget {
+				t.Errorf("HashMeetsTarget() = %v, want %v", got, tt.meetsTarget)
+			}
+		})
+	}
+}
+
+// 同一个块换了难度或者哈希算法，工作量证明就不一定成立
+func TestValidateParams(t *testing.T) {
+	b := newTestBlock("genesis")
+	err := New(b, 12).Mine(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha3, err := LookupHash("sha3-256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		proof *ProofOfWork
+		valid bool
+	}{
+		{"same params", New(b, 12), true},
+		{"other target bits", New(b, 13), false}, //难度也是哈希的输入
+		{"lower target bits", New(b, 11), false},
+		{"other hash", NewWithHash(b, 12, sha3), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.proof.Validate(); got != tt.valid {
+				t.Errorf("Validate() = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestMineNonceExhausted(t *testing.T) {
+	tests := []struct {
+		name       string
+		targetBits int
+		maxNonce   int
+		err        error
+	}{
+		{"unreachable target", 64, 100, ErrNonceExhausted},
+		{"single attempt", 255, 1, ErrNonceExhausted},
+		{"enough attempts", testTargetBits, 1 << 20, nil},
+		{"no limit", testTargetBits, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBlock(tt.name)
+			proof := New(b, tt.targetBits)
+			proof.SetMaxNonce(tt.maxNonce)
+			err := proof.Mine(nil)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Mine() error = %v, want %v", err, tt.err)
+			}
+			if err != nil && len(b.Hash) != 0 {
+				t.Errorf("block hash = %x after a failed Mine, want it unchanged", b.Hash)
+			}
+		})
+	}
+}
+
+func TestLookupHash(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"sha256", nil},
+		{"sha256d", nil},
+		{"sha3-256", nil},
+		{"md5", ErrUnknownHash},
+		{"", ErrUnknownHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LookupHash(tt.name)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("LookupHash(%q) error = %v, want %v", tt.name, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckTargetBits(t *testing.T) {
+	tests := []struct {
+		targetBits int
+		err        error
+	}{
+		{-1, ErrTargetBits},
+		{0, ErrTargetBits}, //任何哈希都满足目标
+		{1, nil},
+		{DefaultTargetBits, nil},
+		{255, nil},
+		{256, ErrTargetBits}, //目标为 1，只有全 0 的哈希满足
+		{1 << 20, ErrTargetBits},
+	}
+
+	for _, tt := range tests {
+		err := CheckTargetBits(tt.targetBits)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("CheckTargetBits(%d) = %v, want %v", tt.targetBits, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"io"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//==========================================备份===========================================
+/**
+CLI 正在写入时直接拷贝 db/blockchain.db，可能拷贝到写了一半的文件。
+Backup 在一个 bolt 读事务中用 tx.WriteTo 把整个数据库写出去，读事务看到的是一个一致的快照，备份期间其他写入不受影响。
+备份文件本身就是一个完整的 bolt 文件，包括区块、元数据和所有索引，恢复时的校验和替换见 chain 包的 Restore。
+*/
+
+// 在一个读事务中把整个数据库写入 w，返回写入的字节数
+func (s *BoltStore) Backup(w io.Writer) (int64, error) {
+	var n int64
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+
+	return n, err
+}
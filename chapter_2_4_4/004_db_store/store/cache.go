@@ -0,0 +1,202 @@
+package store
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+//==========================================区块缓存===========================================
+/**
+BlockchainIterator.Next 每走一步都要开一个读事务并用 gob 解码一个块，反复 printchain 或者校验时，同样的块会被一次次地重新解码。
+CachedStore 包在任意一个 BlockStore 外面，用一个有容量上限的 LRU（最近最少使用）缓存保存解码后的区块，键是区块哈希：
+1.迭代器和所有按哈希取块的接口都经过它，共用同一份缓存
+2.缓存满了以后淘汰最久没有被访问的块
+3.区块体被裁剪、发生链重组时，相关的块会从缓存中移除
+4.缓存中保存的和返回给调用者的都是区块的深拷贝，调用者修改 Data、Hash 不会改到缓存里的块
+未命中时先读被包装的存储再放入缓存，这两步之间块可能被裁剪并移除出缓存。每次移除都让代数加一，
+读之前和放入之前代数不同就不放入，避免把裁剪前的旧块放回缓存。
+命中和未命中次数可以通过 Stats（或者 chain 包的 Blockchain.CacheStats）查看。
+*/
+
+// 默认缓存的区块数
+const DefaultCacheSize = 1024
+
+// CacheStats 是缓存的统计信息
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int //当前缓存的块数
+	Capacity  int
+}
+
+// CachedStore 是带 LRU 缓存的 BlockStore
+type CachedStore struct {
+	BlockStore //没有被重写的方法直接交给被包装的存储
+
+	mu       sync.Mutex
+	capacity int
+	lru      *list.List               //最近访问的在前面，元素的值为 *cacheEntry
+	entries  map[string]*list.Element //哈希 -> lru 中的元素
+	gen      uint64                   //缓存的代数，每次移除块都加一
+
+	hits, misses, evictions uint64
+}
+
+type cacheEntry struct {
+	key   string
+	block *block.Block
+}
+
+func NewCachedStore(store BlockStore, capacity int) *CachedStore {
+	return &CachedStore{
+		BlockStore: store,
+		capacity:   capacity,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *CachedStore) GetBlock(hash []byte) (*block.Block, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[string(hash)]; ok {
+		c.lru.MoveToFront(e)
+		block := cloneBlock(e.Value.(*cacheEntry).block) //返回副本，调用者修改它不会影响缓存
+		c.mu.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+
+		return block, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+	atomic.AddUint64(&c.misses, 1)
+
+	block, err := c.BlockStore.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	c.add(hash, block, gen)
+
+	return block, nil
+}
+
+func (c *CachedStore) PutBlock(block *block.Block) error {
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+
+	err := c.BlockStore.PutBlock(block)
+	if err != nil {
+		return err
+	}
+	c.add(block.Hash, block, gen)
+
+	return nil
+}
+
+// 先裁剪再移除：反过来的话，两步之间另一个 GetBlock 可能把裁剪前的块又放回缓存
+func (c *CachedStore) PruneBlock(hash []byte) error {
+	err := c.BlockStore.PruneBlock(hash)
+	c.Invalidate(hash)
+
+	return err
+}
+
+// 如果被包装的存储支持迁移就执行它，迁移可能改写区块，所以之后清空缓存
+func (c *CachedStore) Migrate(dryRun bool) ([]Migration, error) {
+	m, ok := c.BlockStore.(Migrator)
+	if !ok {
+		return nil, nil
+	}
+	steps, err := m.Migrate(dryRun)
+	c.Purge()
+
+	return steps, err
+}
+
+// 从缓存中移除指定的块
+func (c *CachedStore) Invalidate(hashes ...[]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for _, hash := range hashes {
+		if e, ok := c.entries[string(hash)]; ok {
+			c.lru.Remove(e)
+			delete(c.entries, string(hash))
+		}
+	}
+}
+
+// 清空缓存
+func (c *CachedStore) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+func (c *CachedStore) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Size:      size,
+		Capacity:  c.capacity,
+	}
+}
+
+// 把块的副本放入缓存。gen 是读取（或写入）这个块之前的代数，之后有块被移除过就不放入，
+// 因为这个块可能正是被移除的那个，它的内容已经过时
+func (c *CachedStore) add(hash []byte, block *block.Block, gen uint64) {
+	if c.capacity <= 0 {
+		return
+	}
+	cached := cloneBlock(block)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[string(hash)]
+	if c.gen != gen {
+		//缓存中已有的这个块也不一定是最新的，一并移除
+		if ok {
+			c.lru.Remove(e)
+			delete(c.entries, string(hash))
+		}
+		return
+	}
+	if ok {
+		e.Value.(*cacheEntry).block = cached
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[string(hash)] = c.lru.PushFront(&cacheEntry{string(hash), cached})
+
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// 区块的深拷贝，字节切片不和原来的块共用底层数组
+func cloneBlock(b *block.Block) *block.Block {
+	clone := *b
+	clone.Data = bytes.Clone(b.Data)
+	clone.PrevBlockHash = bytes.Clone(b.PrevBlockHash)
+	clone.Hash = bytes.Clone(b.Hash)
+
+	return &clone
+}
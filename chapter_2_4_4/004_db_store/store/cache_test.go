@@ -0,0 +1,149 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+// 容量为 2 的缓存：最久没有访问的块先被淘汰，命中、未命中和淘汰次数都要计数
+func TestCachedStoreEviction(t *testing.T) {
+	blocks := testChain(3)
+	a, b, c := blocks[0].Hash, blocks[1].Hash, blocks[2].Hash
+	backend := NewMemoryStore()
+	for _, blk := range blocks {
+		err := backend.PutBlock(blk)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewCachedStore(backend, 2)
+
+	steps := []struct {
+		get  []byte
+		want CacheStats //这一步之后的统计
+	}{
+		{a, CacheStats{Misses: 1, Size: 1}},
+		{a, CacheStats{Hits: 1, Misses: 1, Size: 1}},
+		{b, CacheStats{Hits: 1, Misses: 2, Size: 2}},
+		{a, CacheStats{Hits: 2, Misses: 2, Size: 2}},               //a 变成最近访问的
+		{c, CacheStats{Hits: 2, Misses: 3, Evictions: 1, Size: 2}}, //淘汰 b
+		{a, CacheStats{Hits: 3, Misses: 3, Evictions: 1, Size: 2}}, //a 还在
+		{b, CacheStats{Hits: 3, Misses: 4, Evictions: 2, Size: 2}}, //b 被淘汰过，淘汰 c
+		{c, CacheStats{Hits: 3, Misses: 5, Evictions: 3, Size: 2}}, //淘汰 a
+		{b, CacheStats{Hits: 4, Misses: 5, Evictions: 3, Size: 2}},
+	}
+
+	for i, step := range steps {
+		got, err := s.GetBlock(step.get)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Hash, step.get) {
+			t.Fatalf("step %d: got block %x, want %x", i, got.Hash, step.get)
+		}
+		step.want.Capacity = 2
+		if stats := s.Stats(); stats != step.want {
+			t.Errorf("step %d: stats = %+v, want %+v", i, stats, step.want)
+		}
+	}
+}
+
+// 返回的是副本，调用者修改它不会影响缓存；裁剪后缓存中不能留下旧的区块体
+func TestCachedStoreCopies(t *testing.T) {
+	blocks := testChain(2)
+	s := NewCachedStore(NewMemoryStore(), 4)
+	for _, blk := range blocks {
+		err := s.PutBlock(blk)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash := blocks[1].Hash
+
+	got, err := s.GetBlock(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//字节切片也不能和缓存共用：改写返回的块和传给 PutBlock 的块都不影响缓存
+	data := string(blocks[1].Data)
+	got.Nonce = 42
+	got.Data[0] ^= 0xff
+	got.Hash[0] ^= 0xff
+	blocks[1].Data[0] ^= 0xff
+	again, err := s.GetBlock(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks[1].Data[0] ^= 0xff
+	if again.Nonce != 0 || string(again.Data) != data || !bytes.Equal(again.Hash, hash) {
+		t.Errorf("cached block was modified through a returned copy: %+v", again)
+	}
+
+	err = s.PruneBlock(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := s.GetBlock(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned.Data) != 0 {
+		t.Errorf("data = %q after pruning, want it gone", pruned.Data)
+	}
+
+	_, err = s.GetBlock([]byte("missing"))
+	if !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("GetBlock(missing) error = %v, want ErrBlockNotFound", err)
+	}
+}
+
+// 读取被包装的存储之后调用一次 afterGet，模拟未命中时另一个 goroutine 在读和放入缓存之间裁剪了这个块
+type interleavedStore struct {
+	BlockStore
+	afterGet func()
+}
+
+func (s *interleavedStore) GetBlock(hash []byte) (*block.Block, error) {
+	b, err := s.BlockStore.GetBlock(hash)
+	if f := s.afterGet; f != nil {
+		s.afterGet = nil
+		f()
+	}
+
+	return b, err
+}
+
+// 未命中后读到的旧块不能在裁剪之后被放回缓存
+func TestCachedStorePruneDuringMiss(t *testing.T) {
+	blocks := testChain(2)
+	backend := &interleavedStore{BlockStore: NewMemoryStore()}
+	for _, blk := range blocks {
+		err := backend.PutBlock(blk)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewCachedStore(backend, 4)
+	hash := blocks[1].Hash
+
+	backend.afterGet = func() {
+		if err := s.PruneBlock(hash); err != nil {
+			t.Error(err)
+		}
+	}
+	_, err := s.GetBlock(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetBlock(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Data) != 0 {
+		t.Errorf("data = %q after pruning, the stale block was cached", got.Data)
+	}
+}
@@ -0,0 +1,290 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	bolt "go.etcd.io/bbolt"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+//==========================================区块压缩===========================================
+/**
+bolt 中每个块的值原来就是 Block.Serialize() 得到的 gob 数据。现在可以按链选择一种压缩方式（元数据 codec）：
+1.none：不压缩，值还是原来的 gob 数据，与旧文件完全一致
+2.gzip：标准库实现
+3.zstd：压缩率和速度都比 gzip 好
+压缩后的值在最前面加 1 个字节的标记，表示用的是哪种压缩方式。gob 数据的第一个字节是消息长度，
+长度小于 128 时就是长度本身，否则是 0xF8~0xFF，所以 0x80~0xF7 不会出现在未压缩的块的开头，
+decodeBlock 看第一个字节就能区分旧的块和压缩过的块，同一个文件里两种块可以共存。
+压缩只影响 bolt 中保存的值，区块哈希、快照文件的格式都不变。
+*/
+
+const (
+	codecNone = "none"
+	codecGzip = "gzip"
+	codecZstd = "zstd"
+
+	codecKey = "codec"
+)
+
+// 压缩过的块的第一个字节
+const (
+	tagGzip byte = 0x81
+	tagZstd byte = 0x82
+)
+
+var ErrUnknownCodec = errors.New("unknown block codec")
+
+// 支持的压缩方式
+var Codecs = []string{codecNone, codecGzip, codecZstd}
+
+// 单个块解压后的最大长度，防止损坏的数据导致分配过大的内存
+const maxBlockSize = 32 << 20
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxBlockSize))
+	})
+
+	return zstdErr
+}
+
+func checkCodec(codec string) error {
+	for _, c := range Codecs {
+		if c == codec {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w %q, use one of %v", ErrUnknownCodec, codec, Codecs)
+}
+
+// 用指定的方式压缩 gob 数据，codec 为 none 时原样返回
+func compressBlock(encoded []byte, codec string) ([]byte, error) {
+	switch codec {
+	case codecNone, "":
+		return encoded, nil
+	case codecGzip:
+		var buf bytes.Buffer
+		buf.WriteByte(tagGzip)
+		w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write(encoded)
+		if err != nil {
+			return nil, err
+		}
+		err = w.Close()
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case codecZstd:
+		err := initZstd()
+		if err != nil {
+			return nil, err
+		}
+		return zstdEncoder.EncodeAll(encoded, []byte{tagZstd}), nil
+	}
+
+	return nil, checkCodec(codec)
+}
+
+// 还原出 gob 数据，没有压缩标记的旧块原样返回
+func decompressBlock(stored []byte) ([]byte, error) {
+	if len(stored) == 0 {
+		return stored, nil
+	}
+
+	switch stored[0] {
+	case tagGzip:
+		r, err := gzip.NewReader(bytes.NewReader(stored[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("gzip block: %w", err)
+		}
+		encoded, err := io.ReadAll(io.LimitReader(r, maxBlockSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("gzip block: %w", err)
+		}
+		if len(encoded) > maxBlockSize {
+			return nil, errors.New("gzip block: decompressed block is too large")
+		}
+		return encoded, nil
+	case tagZstd:
+		err := initZstd()
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := zstdDecoder.DecodeAll(stored[1:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd block: %w", err)
+		}
+		return encoded, nil
+	}
+
+	return stored, nil
+}
+
+// 解压并解码 bolt 中保存的一个块
+func decodeBlock(stored []byte) (*block.Block, error) {
+	encoded, err := decompressBlock(stored)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", block.ErrCorrupt, err)
+	}
+
+	return block.Deserialize(encoded)
+}
+
+// 存储的值用的是哪种压缩方式
+func codecOf(stored []byte) string {
+	if len(stored) > 0 {
+		switch stored[0] {
+		case tagGzip:
+			return codecGzip
+		case tagZstd:
+			return codecZstd
+		}
+	}
+
+	return codecNone
+}
+
+// 新写入的块使用的压缩方式
+func (s *BoltStore) Codec() string {
+	return s.codec
+}
+
+// 修改压缩方式，并在同一个事务中把已有的块都改写成新的格式，返回改写的块数
+func (s *BoltStore) SetCodec(codec string) (int, error) {
+	err := checkCodec(codec)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+		meta, err := requiredBucket(tx, metaBucket)
+		if err != nil {
+			return err
+		}
+
+		//遍历 bucket 时不能修改它，先把需要改写的块收集起来
+		rewrite := make(map[string][]byte)
+		err = b.ForEach(func(k, v []byte) error {
+			if string(k) == tipKey || codecOf(v) == codec {
+				return nil
+			}
+			encoded, err := decompressBlock(v)
+			if err != nil {
+				return &block.Error{Hash: append([]byte{}, k...), Err: fmt.Errorf("%w: %v", block.ErrCorrupt, err)}
+			}
+			stored, err := compressBlock(encoded, codec)
+			if err != nil {
+				return err
+			}
+			rewrite[string(k)] = stored
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for k, v := range rewrite {
+			err = b.Put([]byte(k), v)
+			if err != nil {
+				return err
+			}
+		}
+		count = len(rewrite)
+
+		return meta.Put([]byte(codecKey), []byte(codec))
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.codec = codec
+
+	return count, nil
+}
+
+//------------------------------------------占用空间统计------------------------------------------
+
+// 统计区块压缩前后占用的空间
+func (s *BoltStore) StorageStats() (StorageStats, error) {
+	stats := StorageStats{Codec: s.codec, ByCodec: make(map[string]int)}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		stats.FileSize = tx.Size()
+
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if string(k) == tipKey {
+				return nil
+			}
+			encoded, err := decompressBlock(v)
+			if err != nil {
+				return &block.Error{Hash: append([]byte{}, k...), Err: fmt.Errorf("%w: %v", block.ErrCorrupt, err)}
+			}
+			stats.Blocks++
+			stats.ByCodec[codecOf(v)]++
+			stats.RawBytes += int64(len(encoded))
+			stats.StoredBytes += int64(len(v))
+
+			return nil
+		})
+	})
+
+	return stats, err
+}
+
+// StorageStats 是区块在 bolt 文件中占用空间的统计
+type StorageStats struct {
+	Codec       string         //新写入的块使用的压缩方式
+	Blocks      int            //已存储的块数
+	ByCodec     map[string]int //每种压缩方式的块数
+	RawBytes    int64          //不压缩时区块占用的字节数
+	StoredBytes int64          //实际占用的字节数
+	FileSize    int64          //bolt 文件的大小
+}
+
+// 压缩节省的字节数
+func (s StorageStats) Saved() int64 {
+	return s.RawBytes - s.StoredBytes
+}
+
+// 压缩节省的比例，0~100
+func (s StorageStats) SavedPercent() float64 {
+	if s.RawBytes == 0 {
+		return 0
+	}
+
+	return float64(s.Saved()) * 100 / float64(s.RawBytes)
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	b := block.Block{Timestamp: 1700000000, Data: bytes.Repeat([]byte("send 1BTC to Pig "), 100), PrevBlockHash: []byte{1}, Hash: []byte{2}}
+	encoded, err := b.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		codec string
+		tag   byte //压缩后的第一个字节，0 表示没有标记
+	}{
+		{codecNone, 0},
+		{codecGzip, tagGzip},
+		{codecZstd, tagZstd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.codec, func(t *testing.T) {
+			stored, err := compressBlock(encoded, tt.codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tag == 0 && !bytes.Equal(stored, encoded) {
+				t.Error("uncompressed block differs from the gob data")
+			}
+			if tt.tag != 0 && (stored[0] != tt.tag || len(stored) >= len(encoded)) {
+				t.Errorf("stored %d bytes starting with %#x, want fewer than %d starting with %#x", len(stored), stored[0], len(encoded), tt.tag)
+			}
+			if got := codecOf(stored); got != tt.codec {
+				t.Errorf("codecOf = %q, want %q", got, tt.codec)
+			}
+
+			raw, err := decompressBlock(stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := block.Deserialize(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded.Data, b.Data) || !bytes.Equal(decoded.Hash, b.Hash) {
+				t.Errorf("decoded block %x differs from the original", decoded.Hash)
+			}
+		})
+	}
+}
+
+func TestDecodeCorruptBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored []byte
+	}{
+		{"gzip", []byte{tagGzip, 1, 2, 3}},
+		{"zstd", []byte{tagZstd, 1, 2, 3}},
+		{"gob", []byte{3, 1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := block.Deserialize(tt.stored)
+			if !errors.Is(err, block.ErrCorrupt) {
+				t.Errorf("block.Deserialize(%x) error = %v, want block.ErrCorrupt", tt.stored, err)
+			}
+		})
+	}
+}
+
+// 修改压缩方式时已有的块全部改写，改写后仍然能读出原来的内容
+func TestSetCodec(t *testing.T) {
+	s := newTestBoltStore(t)
+	blocks := testChain(3)
+	for _, b := range blocks {
+		err := s.PutBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		codec     string
+		rewritten int
+		err       error
+	}{
+		{codecGzip, 3, nil},
+		{codecGzip, 0, nil}, //已经是 gzip
+		{codecZstd, 3, nil},
+		{"lz4", 0, ErrUnknownCodec},
+		{codecNone, 3, nil},
+	}
+
+	for _, step := range steps {
+		t.Run(step.codec, func(t *testing.T) {
+			before := s.Codec()
+			count, err := s.SetCodec(step.codec)
+			if !errors.Is(err, step.err) {
+				t.Fatalf("SetCodec(%q) error = %v, want %v", step.codec, err, step.err)
+			}
+			if count != step.rewritten {
+				t.Errorf("SetCodec(%q) rewrote %d blocks, want %d", step.codec, count, step.rewritten)
+			}
+			want := step.codec
+			if err != nil {
+				want = before
+			}
+			if s.Codec() != want {
+				t.Errorf("Codec() = %q, want %q", s.Codec(), want)
+			}
+
+			stats, err := s.StorageStats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.ByCodec[want] != len(blocks) {
+				t.Errorf("blocks by codec = %v, want all %d with %s", stats.ByCodec, len(blocks), want)
+			}
+			for _, b := range blocks {
+				got, err := s.GetBlock(b.Hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got.Data, b.Data) {
+					t.Errorf("block %x data = %q, want %q", b.Hash, got.Data, b.Data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//==========================================数据目录===========================================
+/**
+原来的 NewBlockchain 总是打开相对路径 db/blockchain.db，换一个目录运行程序就会失败或者在别处生成一条新链。
+现在数据库文件的位置由两部分决定：数据目录和链的名字（默认值见 chain.DefaultConfig，CLI 还可以用参数和环境变量指定）。
+最终文件为 <数据目录>/<链的名字>.db，同一个数据目录下可以存放多条互不相干的链，数据目录不存在时会自动创建。
+*/
+
+const chainFileExt = ".db"
+
+// 另一个进程已经打开了同一个链文件
+var ErrChainLocked = errors.New("chain database is locked by another process")
+
+// 计算链文件的路径，必要时创建数据目录
+func ChainPath(dataDir, chain string) (string, error) {
+	if chain == "" || chain != filepath.Base(chain) || strings.HasPrefix(chain, ".") {
+		return "", fmt.Errorf("invalid chain name %q: use a plain file name without directories", chain)
+	}
+
+	err := os.MkdirAll(dataDir, 0700)
+	if err != nil {
+		return "", fmt.Errorf("cannot create data directory: %v", err)
+	}
+
+	return filepath.Join(dataDir, chain+chainFileExt), nil
+}
+
+// 列出数据目录下所有链的名字
+func ListChains(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var chains []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != chainFileExt {
+			continue
+		}
+		chains = append(chains, strings.TrimSuffix(name, chainFileExt))
+	}
+	sort.Strings(chains)
+
+	return chains, nil
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChainPath(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "chains")
+	tests := []struct {
+		chain string
+		ok    bool
+	}{
+		{"blockchain", true},
+		{"team-1", true},
+		{"", false},
+		{"../other", false},
+		{"a/b", false},
+		{".hidden", false},
+	}
+
+	for _, tt := range tests {
+		path, err := ChainPath(dataDir, tt.chain)
+		if (err == nil) != tt.ok {
+			t.Errorf("ChainPath(%q) error = %v, want ok = %v", tt.chain, err, tt.ok)
+			continue
+		}
+		if tt.ok && path != filepath.Join(dataDir, tt.chain+".db") {
+			t.Errorf("ChainPath(%q) = %q", tt.chain, path)
+		}
+	}
+
+	//数据目录不存在时会被创建
+	if info, err := os.Stat(dataDir); err != nil || !info.IsDir() {
+		t.Errorf("data directory was not created: %v", err)
+	}
+}
+
+func TestListChains(t *testing.T) {
+	dataDir := t.TempDir()
+	for _, name := range []string{"b.db", "a.db", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dataDir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dataDir, "dir.db"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	chains, err := ListChains(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(chains, want) {
+		t.Errorf("ListChains = %q, want %q", chains, want)
+	}
+
+	chains, err = ListChains(filepath.Join(dataDir, "missing"))
+	if err != nil || chains != nil {
+		t.Errorf("ListChains(missing dir) = %q, %v, want nil, nil", chains, err)
+	}
+}
+
+// 第二次打开同一个链文件要在超时后报告 ErrChainLocked，而不是一直阻塞
+func TestChainLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locked.db")
+	s, err := NewBoltStore(path, DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, err = NewBoltStore(path, DefaultBucket)
+	if !errors.Is(err, ErrChainLocked) {
+		t.Fatalf("second open: err = %v, want ErrChainLocked", err)
+	}
+}
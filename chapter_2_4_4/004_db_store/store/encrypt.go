@@ -0,0 +1,309 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/scrypt"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+//==========================================区块体加密===========================================
+/**
+db 目录里的 bolt 文件是明文的，任何能读到文件的人都能看到 Block.Data。开启加密模式后：
+1.用 scrypt 从口令派生出 32 字节的密钥，盐和参数保存在元数据 kdf 中，另外保存一段用密钥加密的校验数据 keycheck，用来识别错误的口令
+2.每个区块的 Data 用 AES-GCM 加密后再保存，格式为 12 字节的随机 nonce + 密文，区块哈希作为附加数据，密文不能被挪到别的块上
+3.被加密的区块哈希记录在 encrypted bucket 中
+4.Timestamp、PrevBlockHash、Hash、Nonce 仍然是明文，没有口令也能检查链接关系，并像裁剪过的块一样检查 Hash 是否满足难度目标
+创世块的数据是公开的，不加密，它用来确认链的身份。
+口令由调用者通过 Unlock 提供（CLI 从环境变量 BLOCKCHAIN_PASSPHRASE 读取），没有口令时只能读取区块头，也不能再添加新的块。
+开启加密时 chain 包会删除搜索索引，因为它保存的是明文的词。
+注意 bolt 不会擦除释放的页，开启加密之前写入的明文可能还残留在文件的空闲页中，直到这些页被重新使用。
+*/
+
+const (
+	encryptedBucket = "encrypted" //区块体被加密的区块哈希集合
+	kdfKey          = "kdf"       //16 字节盐 + scrypt 的 N、r、p（各 4 字节）
+	keyCheckKey     = "keycheck"
+
+	//scrypt 参数，派生一次密钥大约需要几十毫秒
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var keyCheckPlaintext = []byte("db-store key check")
+
+var (
+	ErrNoPassphrase     = errors.New("chain is encrypted, a passphrase is needed to read or add block bodies")
+	ErrWrongPassphrase  = errors.New("wrong passphrase")
+	ErrNotEncrypted     = errors.New("chain is not encrypted")
+	ErrAlreadyEncrypted = errors.New("chain is already encrypted")
+)
+
+// 链是否开启了加密模式
+func (s *BoltStore) Encrypted() bool {
+	return s.encrypted
+}
+
+// 用口令派生密钥，之后可以读写加密的区块体
+func (s *BoltStore) Unlock(passphrase string) error {
+	if !s.encrypted {
+		return ErrNotEncrypted
+	}
+
+	var kdf, check []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		meta, err := requiredBucket(tx, metaBucket)
+		if err != nil {
+			return err
+		}
+		kdf = append([]byte{}, meta.Get([]byte(kdfKey))...)
+		check = append([]byte{}, meta.Get([]byte(keyCheckKey))...)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	aead, err := deriveAEAD(passphrase, kdf)
+	if err != nil {
+		return err
+	}
+	plain, err := openSealed(aead, check, []byte(keyCheckKey))
+	if err != nil || !bytes.Equal(plain, keyCheckPlaintext) {
+		return ErrWrongPassphrase
+	}
+	s.aead = aead
+
+	return nil
+}
+
+// 开启加密模式，并在同一个事务中加密所有已有的区块体，返回加密的块数
+func (s *BoltStore) EnableEncryption(passphrase string) (int, error) {
+	if s.encrypted {
+		return 0, ErrAlreadyEncrypted
+	}
+	if passphrase == "" {
+		return 0, errors.New("empty passphrase")
+	}
+
+	kdf := make([]byte, 16+12)
+	_, err := rand.Read(kdf[:16])
+	if err != nil {
+		return 0, err
+	}
+	binary.BigEndian.PutUint32(kdf[16:], scryptN)
+	binary.BigEndian.PutUint32(kdf[20:], scryptR)
+	binary.BigEndian.PutUint32(kdf[24:], scryptP)
+	aead, err := deriveAEAD(passphrase, kdf)
+	if err != nil {
+		return 0, err
+	}
+	check, err := seal(aead, keyCheckPlaintext, []byte(keyCheckKey))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+
+		//遍历 bucket 时不能修改它，先把需要改写的块收集起来
+		var blocks []*block.Block
+		err = b.ForEach(func(k, v []byte) error {
+			if string(k) == tipKey {
+				return nil
+			}
+			decoded, err := decodeBlock(v)
+			if err != nil {
+				return &block.Error{Hash: append([]byte{}, k...), Err: err}
+			}
+			blocks = append(blocks, decoded)
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			if len(block.Data) == 0 || len(block.PrevBlockHash) == 0 {
+				continue
+			}
+			block.Data, err = seal(aead, block.Data, block.Hash)
+			if err != nil {
+				return err
+			}
+			err = s.putEncoded(tx, block, true)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+
+		meta, err := requiredBucket(tx, metaBucket)
+		if err != nil {
+			return err
+		}
+		err = meta.Put([]byte(kdfKey), kdf)
+		if err != nil {
+			return err
+		}
+
+		return meta.Put([]byte(keyCheckKey), check)
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.encrypted = true
+	s.aead = aead
+
+	return count, nil
+}
+
+// 区块体是否被加密且当前没有口令无法解密
+func (s *BoltStore) IsLocked(hash []byte) (bool, error) {
+	if !s.encrypted || s.aead != nil {
+		return false, nil
+	}
+
+	var locked bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, encryptedBucket)
+		if err != nil {
+			return err
+		}
+		locked = b.Get(hash) != nil
+
+		return nil
+	})
+
+	return locked, err
+}
+
+// 加密模式下把要保存的块的 Data 换成密文，返回要保存的块以及它是否被加密
+func (s *BoltStore) sealBody(block *block.Block) (*block.Block, bool, error) {
+	if !s.encrypted || len(block.Data) == 0 || len(block.PrevBlockHash) == 0 {
+		return block, false, nil
+	}
+	if s.aead == nil {
+		return nil, false, ErrNoPassphrase
+	}
+
+	sealed := *block
+	var err error
+	sealed.Data, err = seal(s.aead, block.Data, block.Hash)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &sealed, true, nil
+}
+
+// 解密从 bolt 中读出的块，没有口令时只保留区块头
+func (s *BoltStore) openBody(tx *bolt.Tx, b *block.Block) error {
+	if !s.encrypted {
+		return nil
+	}
+	enc, err := requiredBucket(tx, encryptedBucket)
+	if err != nil {
+		return err
+	}
+	if enc.Get(b.Hash) == nil {
+		return nil
+	}
+	if s.aead == nil {
+		b.Data = nil
+		return nil
+	}
+
+	data, err := openSealed(s.aead, b.Data, b.Hash)
+	if err != nil {
+		return &block.Error{Hash: b.Hash, Err: fmt.Errorf("cannot decrypt body: %w", err)}
+	}
+	b.Data = data
+
+	return nil
+}
+
+// 按当前的压缩方式写入一个（已经处理过加密的）块，并更新 encrypted bucket
+func (s *BoltStore) putEncoded(tx *bolt.Tx, block *block.Block, encrypted bool) error {
+	b, err := requiredBucket(tx, s.bucket)
+	if err != nil {
+		return err
+	}
+	enc, err := requiredBucket(tx, encryptedBucket)
+	if err != nil {
+		return err
+	}
+
+	serialized, err := block.Serialize()
+	if err != nil {
+		return err
+	}
+	encoded, err := compressBlock(serialized, s.codec)
+	if err != nil {
+		return err
+	}
+	err = b.Put(block.Hash, encoded)
+	if err != nil {
+		return err
+	}
+
+	if encrypted {
+		return enc.Put(block.Hash, []byte{})
+	}
+
+	return enc.Delete(block.Hash)
+}
+
+func deriveAEAD(passphrase string, kdf []byte) (cipher.AEAD, error) {
+	if len(kdf) != 16+12 {
+		return nil, errors.New("invalid key derivation parameters")
+	}
+	n := int(binary.BigEndian.Uint32(kdf[16:]))
+	r := int(binary.BigEndian.Uint32(kdf[20:]))
+	p := int(binary.BigEndian.Uint32(kdf[24:]))
+
+	key, err := scrypt.Key([]byte(passphrase), kdf[:16], n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// nonce + 密文
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func openSealed(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+// 开启加密后，除创世块以外的区块体在文件中都是密文；重新打开后要用正确的口令解锁才能读出
+func TestEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := NewBoltStore(path, DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := testChain(3)
+	for _, b := range blocks {
+		err = s.PutBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := s.EnableEncryption(testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(blocks)-1 {
+		t.Errorf("encrypted %d blocks, want %d (all but genesis)", count, len(blocks)-1)
+	}
+	if _, err := s.EnableEncryption(testPassphrase); !errors.Is(err, ErrAlreadyEncrypted) {
+		t.Errorf("second EnableEncryption error = %v, want ErrAlreadyEncrypted", err)
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		for _, b := range blocks[1:] {
+			if raw := tx.Bucket([]byte(DefaultBucket)).Get(b.Hash); bytes.Contains(raw, b.Data) {
+				t.Errorf("block %x is stored in plain text", b.Hash)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	tests := []struct {
+		name       string
+		passphrase string //空表示不解锁
+		unlockErr  error
+		locked     bool
+	}{
+		{"no passphrase", "", nil, true},
+		{"wrong passphrase", "wrong", ErrWrongPassphrase, true},
+		{"right passphrase", testPassphrase, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewBoltStore(path, DefaultBucket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if !s.Encrypted() {
+				t.Fatal("Encrypted() = false after reopening")
+			}
+			if tt.passphrase != "" {
+				err = s.Unlock(tt.passphrase)
+				if !errors.Is(err, tt.unlockErr) {
+					t.Fatalf("Unlock error = %v, want %v", err, tt.unlockErr)
+				}
+			}
+
+			for i, b := range blocks {
+				got, err := s.GetBlock(b.Hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				locked, err := s.IsLocked(b.Hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantLocked := tt.locked && i > 0 //创世块不加密
+				if locked != wantLocked {
+					t.Errorf("block %d: IsLocked = %v, want %v", i, locked, wantLocked)
+				}
+				wantData := b.Data
+				if wantLocked {
+					wantData = nil
+				}
+				if !bytes.Equal(got.Data, wantData) {
+					t.Errorf("block %d: data = %q, want %q", i, got.Data, wantData)
+				}
+			}
+
+			//没有口令时不能再写入新的区块体
+			next := &block.Block{Timestamp: 1800000000, Data: []byte("next"), PrevBlockHash: blocks[len(blocks)-1].Hash, Hash: []byte("next")}
+			err = s.PutBlock(next)
+			var wantErr error
+			if tt.locked {
+				wantErr = ErrNoPassphrase
+			}
+			if !errors.Is(err, wantErr) {
+				t.Errorf("PutBlock error = %v, want %v", err, wantErr)
+			}
+		})
+	}
+}
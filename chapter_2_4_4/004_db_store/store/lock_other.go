@@ -0,0 +1,23 @@
+//go:build !unix
+
+package store
+
+import (
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+)
+
+// 没有 flock 的平台上直接用 bolt.Open 加锁，不检查 bucket；文件头损坏时无法加锁，返回 ErrCorruptDatabase
+func LockFile(path string) (func() error, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: lockTimeout})
+	if err == berrors.ErrTimeout {
+		return nil, lockedError(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorruptDatabase, path, err)
+	}
+
+	return db.Close, nil
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package store
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+//==========================================文件锁===========================================
+/**
+BoltDB 在 unix 上用 flock 给整个文件加排他锁，同一时间只有一个进程能以读写方式打开链文件。
+恢复备份时要先确认原来的链文件没有被别的进程使用，但这个文件可能已经损坏，用 NewBoltStore 打开会先校验内容而失败。
+LockFile 不读取文件内容，只加一个和 BoltDB 相同的锁：别的进程打开着这个链文件时失败，拿到锁以后别的进程也打不开它。
+*/
+
+// 给 path 加上和 BoltDB 相同的排他锁，不校验文件内容；返回释放锁的函数
+func LockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return f.Close, nil //关闭文件即释放锁
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	f.Close()
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return nil, lockedError(path)
+	}
+
+	return nil, err
+}
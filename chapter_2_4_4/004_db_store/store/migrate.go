@@ -0,0 +1,239 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+//==========================================数据库版本与迁移===========================================
+/**
+最早的 bolt 文件里只有区块的 bucket（默认是 blocks）和魔法键 "l"，文件本身没有记录它的值是什么格式。
+现在 meta bucket 中保存：
+1.version：数据库结构的版本号
+2.genesis：创世块哈希，用来确认这是哪一条链
+3.chainid：链的标识
+4.targetbits、hashalg：创建链时确定的挖矿难度和哈希算法，旧文件没有记录，由打开链的配置决定
+chain.New 打开数据库时会运行迁移：从文件当前的版本开始，逐个执行比它新的迁移步骤，每一步在一个独立的事务中完成并更新版本号，
+中途失败的话，文件停留在最后一个成功的版本上，下次打开时从那里继续。
+dry-run 模式会在同一个事务里执行全部步骤，然后回滚，只报告将要执行什么。
+*/
+
+const (
+	schemaVersionKey = "version"
+	GenesisHashKey   = "genesis"
+	ChainIDKey       = "chainid"
+	TargetBitsKey    = "targetbits"
+	HashAlgorithmKey = "hashalg"
+)
+
+// 主链 高度 -> 区块哈希 的索引，由迁移步骤 2 建立，之后由 chain 包随主链的变化维护
+const HeightsIndex = "heights"
+
+// 高度索引的键，8 字节大端序，bolt 中的键顺序就是高度顺序
+func HeightKey(height int) []byte {
+	return block.IntToHex(int64(height))
+}
+
+// Migration 是把数据库从 Version-1 升级到 Version 的一个步骤，bucket 是区块所在的 bucket
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(tx *bolt.Tx, bucket string) error
+}
+
+// Migrator 是支持数据库迁移的存储，chain.New 打开存储时会调用它
+type Migrator interface {
+	Migrate(dryRun bool) ([]Migration, error)
+}
+
+// 按版本号排列的全部迁移步骤，新的步骤只能追加在末尾
+var migrations = []Migration{
+	{1, "record schema version, genesis hash and chain id in the meta bucket", migrateMeta},
+	{2, "build the height -> hash index of the main chain", migrateHeights},
+}
+
+// 当前程序使用的数据库版本
+var LatestSchemaVersion = migrations[len(migrations)-1].Version
+
+var (
+	ErrSchemaTooNew = errors.New("database schema is newer than this program supports")
+	errDryRun       = errors.New("dry run")
+)
+
+// 读取数据库的版本号，没有记录版本的旧文件为 0
+func (s *BoltStore) SchemaVersion() (int, error) {
+	var version int
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		version = schemaVersionOf(tx)
+		return nil
+	})
+
+	return version, err
+}
+
+// 执行所有比当前版本新的迁移步骤，返回执行了（dry-run 时为将要执行）的步骤
+func (s *BoltStore) Migrate(dryRun bool) ([]Migration, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > LatestSchemaVersion {
+		return nil, fmt.Errorf("%w: file is version %d, latest known is %d", ErrSchemaTooNew, version, LatestSchemaVersion)
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	if dryRun {
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			for _, m := range pending {
+				err := applyMigration(tx, m, s.bucket)
+				if err != nil {
+					return err
+				}
+			}
+
+			return errDryRun //返回错误让 bolt 回滚整个事务
+		})
+		if err != errDryRun {
+			return nil, err
+		}
+
+		return pending, nil
+	}
+
+	for i, m := range pending {
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			return applyMigration(tx, m, s.bucket)
+		})
+		if err != nil {
+			return pending[:i], err
+		}
+	}
+
+	return pending, nil
+}
+
+func applyMigration(tx *bolt.Tx, m Migration, bucket string) error {
+	err := m.Apply(tx, bucket)
+	if err != nil {
+		return fmt.Errorf("migration to version %d (%s): %w", m.Version, m.Description, err)
+	}
+
+	meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+
+	return meta.Put([]byte(schemaVersionKey), block.IntToHex(int64(m.Version)))
+}
+
+func schemaVersionOf(tx *bolt.Tx) int {
+	meta := tx.Bucket([]byte(metaBucket))
+	if meta == nil {
+		return 0
+	}
+	v := meta.Get([]byte(schemaVersionKey))
+	if len(v) != 8 {
+		return 0
+	}
+
+	return int(binary.BigEndian.Uint64(v))
+}
+
+// 在事务中从 bucket 的 "l" 往回走，返回从 tip 到创世块的哈希
+func mainChainHashes(tx *bolt.Tx, bucket string) ([][]byte, error) {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil, nil
+	}
+
+	var hashes [][]byte
+	hash := b.Get([]byte(tipKey))
+	for len(hash) != 0 {
+		encodedBlock := b.Get(hash)
+		if encodedBlock == nil {
+			return nil, fmt.Errorf("%w: main chain is broken at %x", ErrBlockNotFound, hash)
+		}
+		decoded, err := decodeBlock(encodedBlock)
+		if err != nil {
+			return nil, &block.Error{Hash: append([]byte{}, hash...), Err: err}
+		}
+		hashes = append(hashes, append([]byte{}, hash...))
+		hash = decoded.PrevBlockHash
+	}
+
+	return hashes, nil
+}
+
+//------------------------------------------迁移步骤------------------------------------------
+
+// 版本 1：记录创世块哈希和链标识
+func migrateMeta(tx *bolt.Tx, bucket string) error {
+	meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+
+	hashes, err := mainChainHashes(tx, bucket)
+	if err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return errors.New("database contains no chain")
+	}
+	genesis := hashes[len(hashes)-1]
+
+	err = meta.Put([]byte(GenesisHashKey), genesis)
+	if err != nil {
+		return err
+	}
+	if meta.Get([]byte(ChainIDKey)) == nil {
+		//旧文件没有链标识，用创世块哈希的前 8 个字节代替
+		err = meta.Put([]byte(ChainIDKey), []byte(fmt.Sprintf("%x", genesis[:8])))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 版本 2：为主链建立 高度 -> 哈希 的索引
+func migrateHeights(tx *bolt.Tx, bucket string) error {
+	err := tx.DeleteBucket([]byte(HeightsIndex))
+	if err != nil && err != berrors.ErrBucketNotFound {
+		return err
+	}
+	b, err := tx.CreateBucket([]byte(HeightsIndex))
+	if err != nil {
+		return err
+	}
+
+	hashes, err := mainChainHashes(tx, bucket)
+	if err != nil {
+		return err
+	}
+	for i, hash := range hashes {
+		err = b.Put(HeightKey(len(hashes)-1-i), hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
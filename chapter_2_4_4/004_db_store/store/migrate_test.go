@@ -0,0 +1,172 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+// 按最早的格式写一个链文件：只有区块的 bucket 和指向 tip 的 "l"，没有元数据
+func writeLegacyFile(t *testing.T, bucket string, blocks []*block.Block) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		for _, blk := range blocks {
+			serialized, err := blk.Serialize()
+			if err != nil {
+				return err
+			}
+			err = b.Put(blk.Hash, serialized)
+			if err != nil {
+				return err
+			}
+		}
+
+		return b.Put([]byte(tipKey), blocks[len(blocks)-1].Hash)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestMigrateLegacyFile(t *testing.T) {
+	blocks := testChain(4)
+	genesis := blocks[0].Hash
+
+	tests := []struct {
+		name   string
+		bucket string
+		dryRun bool
+	}{
+		{"dry run", DefaultBucket, true},
+		{"migrate", DefaultBucket, false},
+		{"custom bucket", "chain", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewBoltStore(writeLegacyFile(t, tt.bucket, blocks), tt.bucket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			steps, err := s.Migrate(tt.dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(steps) != LatestSchemaVersion {
+				t.Errorf("Migrate ran %d steps, want %d", len(steps), LatestSchemaVersion)
+			}
+
+			wantVersion := LatestSchemaVersion
+			if tt.dryRun {
+				wantVersion = 0
+			}
+			version, err := s.SchemaVersion()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != wantVersion {
+				t.Errorf("SchemaVersion = %d, want %d", version, wantVersion)
+			}
+			if tt.dryRun {
+				if g, _ := s.GetMeta(GenesisHashKey); g != nil {
+					t.Error("dry run wrote the genesis hash")
+				}
+				return
+			}
+
+			meta := []struct {
+				key  string
+				want []byte
+			}{
+				{GenesisHashKey, genesis},
+				{ChainIDKey, []byte(fmt.Sprintf("%x", genesis[:8]))},
+			}
+			for _, m := range meta {
+				got, err := s.GetMeta(m.key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, m.want) {
+					t.Errorf("meta %s = %x, want %x", m.key, got, m.want)
+				}
+			}
+			for height, b := range blocks {
+				hash, err := s.GetIndex(HeightsIndex, HeightKey(height))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(hash, b.Hash) {
+					t.Errorf("height %d indexed as %x, want %x", height, hash, b.Hash)
+				}
+			}
+
+			//已经是最新版本，再次迁移什么也不做
+			steps, err = s.Migrate(false)
+			if err != nil || len(steps) != 0 {
+				t.Errorf("second Migrate = %d steps, %v, want nothing to do", len(steps), err)
+			}
+		})
+	}
+}
+
+func TestMigrateSchemaTooNew(t *testing.T) {
+	s := newTestBoltStore(t)
+	err := s.PutMeta(schemaVersionKey, block.IntToHex(int64(LatestSchemaVersion+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Migrate(false)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Migrate error = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+// 已有的文件里没有配置的 bucket 时打开失败，不能在里面新建一条空链
+func TestOpenWithOtherBucket(t *testing.T) {
+	path := writeLegacyFile(t, DefaultBucket, testChain(2))
+
+	tests := []struct {
+		bucket string
+		err    error
+	}{
+		{DefaultBucket, nil},
+		{"chain", ErrInvalidBucket},
+		{"", ErrInvalidBucket},
+		{metaBucket, ErrInvalidBucket},
+		{SearchIndex, ErrInvalidBucket}, //chain 包的搜索索引
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bucket, func(t *testing.T) {
+			s, err := NewBoltStore(path, tt.bucket)
+			if err == nil {
+				s.Close()
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("NewBoltStore(%q) error = %v, want %v", tt.bucket, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,686 @@
+package store
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+//==========================================存储后端===========================================
+/**
+002 中的区块链原来把区块放在内存切片里，004 则直接把 *bolt.DB 写死在 Blockchain 和迭代器里。
+为了让两种存储方式共用同一套区块链逻辑（002 现在也用 chain 包，区块放在 MemoryStore 里），这里把存储抽象成 BlockStore 接口：
+1.按哈希读取一个区块
+2.写入一个区块（键为区块哈希）
+3.读取/设置 tip（最后一个块的哈希），设置可以是比较并交换（compare-and-swap），防止覆盖别人刚写入的 tip
+4.遍历存储中的所有区块
+5.裁剪区块体（只保留区块头）以及读写少量元数据
+6.读写派生索引（例如高度索引、搜索索引），每个索引是一个独立的 bucket，可以按键的前缀有序遍历
+chain 包的 Blockchain 和 BlockchainIterator 只依赖这个接口，BoltStore 用于持久化，MemoryStore 用于测试和演示。
+BoltStore 使用 BoltDB 的维护分支 go.etcd.io/bbolt，文件格式和原来的 github.com/boltdb/bolt 完全相同；
+原来的库已经停止维护，在 go test -race 打开的 checkptr 检查下创建 bucket 时会崩溃。
+区块所在的 bucket 名由打开文件的一方指定，默认是原来的 "blocks"。已有的文件里没有这个 bucket 时打开失败，
+而不是新建一个空 bucket，否则换了 bucket 名打开旧文件就会悄悄地在同一个文件里开始一条新链。
+*/
+
+var (
+	ErrBlockNotFound   = errors.New("block not found") //读取一个不存在的区块时返回
+	ErrCorruptDatabase = errors.New("corrupt or invalid database file")
+	ErrMissingBucket   = errors.New("bucket missing from database")
+	ErrInvalidBucket   = errors.New("invalid block bucket name")
+)
+
+// BlockStore 是区块存储后端需要实现的接口
+type BlockStore interface {
+	GetBlock(hash []byte) (*block.Block, error)                                    //按哈希取出区块，不存在时返回 ErrBlockNotFound
+	PutBlock(block *block.Block) error                                             //以区块哈希为键保存区块
+	GetTip() ([]byte, error)                                                       //取出最后一个块的哈希，空链返回 nil
+	SetTip(hash []byte) error                                                      //无条件更新最后一个块的哈希
+	CompareAndSwapTip(old, new []byte) (bool, error)                               //只有 tip 仍然是 old 时才更新为 new，返回是否更新了
+	ForEach(fn func(key []byte, block *block.Block) error) error                   //遍历所有已存储的区块及其键，顺序不保证
+	PruneBlock(hash []byte) error                                                  //删除区块体 Data，只保留区块头
+	IsPruned(hash []byte) (bool, error)                                            //区块体是否已经被裁剪
+	GetMeta(key string) ([]byte, error)                                            //读取元数据，不存在时返回 nil
+	PutMeta(key string, value []byte) error                                        //写入元数据
+	GetIndex(index string, key []byte) ([]byte, error)                             //读取索引项，不存在时返回 nil
+	PutIndex(index string, key, value []byte) error                                //写入索引项
+	DeleteIndex(index string, key []byte) error                                    //删除索引项
+	ScanIndex(index string, prefix []byte, fn func(key, value []byte) error) error //按键的字节序遍历以 prefix 开头的索引项
+	DropIndex(index string) error                                                  //删除整个索引
+	Close() error
+}
+
+//------------------------------------------BoltDB 实现------------------------------------------
+
+const (
+	DefaultBucket = "blocks" //区块所在的 bucket，原来的 db/blockchain.db 使用的名字
+	tipKey        = "l"      //bucket 中保存最后一个块哈希的键
+)
+
+const (
+	prunedBucket = "pruned" //被裁剪了区块体的区块哈希集合
+	metaBucket   = "meta"   //链的元数据
+)
+
+// BoltDB 用文件锁保证同一时间只有一个进程打开数据库，等待超过这个时间就认为被别的进程占用
+const lockTimeout = time.Second
+
+// BoltStore 把区块保存在 BoltDB 的一个 bucket 里，不压缩时格式与原来的 db/blockchain.db 完全一致
+type BoltStore struct {
+	db        *bolt.DB
+	bucket    string      //区块所在的 bucket
+	codec     string      //新写入的块使用的压缩方式，见 codec.go
+	encrypted bool        //是否开启了加密模式，见 encrypt.go
+	aead      cipher.AEAD //由口令派生的密钥，没有口令时为 nil
+}
+
+// 打开（必要时创建）一个 BoltDB 文件，区块保存在名为 bucket 的 bucket 里，只有新文件才会创建它
+func NewBoltStore(path, bucket string) (*BoltStore, error) {
+	return openBoltStore(path, bucket, false)
+}
+
+// 只读地打开一个已有的 BoltDB 文件：不创建 bucket，任何写入都会失败。用来检查不应被改动的文件，例如待恢复的备份
+func OpenBoltStoreReadOnly(path, bucket string) (*BoltStore, error) {
+	return openBoltStore(path, bucket, true)
+}
+
+// 搜索索引所在的 bucket，由 chain 包维护（见 chain/search.go），区块不能使用这个名字
+const SearchIndex = "search"
+
+// 区块的 bucket 不能为空，也不能和存储自己使用的 bucket 或者索引重名
+func CheckBucket(bucket string) error {
+	if bucket == "" {
+		return fmt.Errorf("%w: name is empty", ErrInvalidBucket)
+	}
+	for _, reserved := range []string{prunedBucket, metaBucket, encryptedBucket, HeightsIndex, SearchIndex} {
+		if bucket == reserved {
+			return fmt.Errorf("%w: %q is used for other data", ErrInvalidBucket, bucket)
+		}
+	}
+
+	return nil
+}
+
+// 链文件被另一个进程打开时的错误，说明怎样解决
+func lockedError(path string) error {
+	return fmt.Errorf("%w: %s is already opened by another db-store process "+
+		"(BoltDB allows a single process per file); wait for it to finish or use another -chain/-datadir", ErrChainLocked, path)
+}
+
+func openBoltStore(path, bucket string, readOnly bool) (*BoltStore, error) {
+	err := CheckBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	//不设置超时的话，文件被另一个进程打开时 bolt.Open 会一直阻塞
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: lockTimeout, ReadOnly: readOnly})
+	if err == berrors.ErrTimeout {
+		return nil, lockedError(path)
+	}
+	if err == berrors.ErrInvalid || err == berrors.ErrVersionMismatch || err == berrors.ErrChecksum {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorruptDatabase, path, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BoltStore{db: db, bucket: bucket, codec: codecNone}
+	load := func(tx *bolt.Tx) error {
+		if !readOnly {
+			if tx.Bucket([]byte(bucket)) == nil && !isEmpty(tx) {
+				return fmt.Errorf("%w: %s has no bucket %q, the chain was created with another bucket name", ErrInvalidBucket, path, bucket)
+			}
+			for _, name := range []string{bucket, prunedBucket, metaBucket, encryptedBucket} {
+				_, err := tx.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if meta := tx.Bucket([]byte(metaBucket)); meta != nil {
+			if codec := meta.Get([]byte(codecKey)); codec != nil {
+				s.codec = string(codec)
+			}
+			s.encrypted = meta.Get([]byte(kdfKey)) != nil
+		}
+
+		return checkCodec(s.codec)
+	}
+	if readOnly {
+		err = db.View(load)
+	} else {
+		err = db.Update(load)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// 文件中还没有任何 bucket，也就是刚刚创建的文件
+func isEmpty(tx *bolt.Tx) bool {
+	empty := true
+	tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		empty = false
+		return nil
+	})
+
+	return empty
+}
+
+// 区块所在的 bucket
+func (s *BoltStore) Bucket() string {
+	return s.bucket
+}
+
+func (s *BoltStore) GetBlock(hash []byte) (*block.Block, error) {
+	var block *block.Block
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+		encodedBlock := b.Get(hash)
+		if encodedBlock == nil {
+			return ErrBlockNotFound
+		}
+		block, err = decodeBlock(encodedBlock)
+		if err != nil {
+			return err
+		}
+
+		return s.openBody(tx, block)
+	})
+
+	return block, err
+}
+
+func (s *BoltStore) PutBlock(b *block.Block) error {
+	if len(b.Hash) == 0 {
+		return fmt.Errorf("%w: block has no hash", block.ErrInvalid)
+	}
+	stored, encrypted, err := s.sealBody(b)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.putEncoded(tx, stored, encrypted)
+	})
+}
+
+func (s *BoltStore) GetTip() ([]byte, error) {
+	var tip []byte
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+		//bolt 返回的切片只在事务内有效，需要拷贝出来
+		if l := b.Get([]byte(tipKey)); l != nil {
+			tip = append([]byte{}, l...)
+		}
+
+		return nil
+	})
+
+	return tip, err
+}
+
+func (s *BoltStore) SetTip(hash []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(tipKey), hash)
+	})
+}
+
+// 读取和写入在同一个读写事务中完成，bolt 同一时间只允许一个读写事务，所以比较和交换之间不会插入别的写入
+func (s *BoltStore) CompareAndSwapTip(old, new []byte) (bool, error) {
+	swapped := false
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(b.Get([]byte(tipKey)), old) {
+			return nil
+		}
+		swapped = true
+
+		return b.Put([]byte(tipKey), new)
+	})
+
+	return swapped, err
+}
+
+func (s *BoltStore) ForEach(fn func(key []byte, block *block.Block) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if string(k) == tipKey {
+				return nil
+			}
+
+			decoded, err := decodeBlock(v)
+			if err != nil {
+				return &block.Error{Hash: append([]byte{}, k...), Err: err}
+			}
+			err = s.openBody(tx, decoded)
+			if err != nil {
+				return err
+			}
+
+			return fn(append([]byte{}, k...), decoded)
+		})
+	})
+}
+
+// 和 ForEach 一样遍历所有区块，但遇到无法解码或解密的块不会停止，而是把错误（*block.Error）交给 fn，由 fn 决定是否继续
+func (s *BoltStore) ScanBlocks(fn func(key []byte, b *block.Block, err error) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if string(k) == tipKey {
+				return nil
+			}
+			key := append([]byte{}, k...)
+
+			decoded, err := decodeBlock(v)
+			if err != nil {
+				return fn(key, nil, &block.Error{Hash: key, Err: err})
+			}
+			err = s.openBody(tx, decoded)
+			if err != nil {
+				return fn(key, nil, err)
+			}
+
+			return fn(key, decoded, nil)
+		})
+	})
+}
+
+func (s *BoltStore) PruneBlock(hash []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, s.bucket)
+		if err != nil {
+			return err
+		}
+		pruned, err := requiredBucket(tx, prunedBucket)
+		if err != nil {
+			return err
+		}
+		encodedBlock := b.Get(hash)
+		if encodedBlock == nil {
+			return ErrBlockNotFound
+		}
+		header, err := decodeBlock(encodedBlock)
+		if err != nil {
+			return err
+		}
+		header.Data = nil
+
+		err = s.putEncoded(tx, header, false)
+		if err != nil {
+			return err
+		}
+
+		return pruned.Put(hash, []byte{})
+	})
+}
+
+func (s *BoltStore) IsPruned(hash []byte) (bool, error) {
+	var pruned bool
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, prunedBucket)
+		if err != nil {
+			return err
+		}
+		pruned = b.Get(hash) != nil
+
+		return nil
+	})
+
+	return pruned, err
+}
+
+func (s *BoltStore) GetMeta(key string) ([]byte, error) {
+	var value []byte
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, metaBucket)
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			value = append([]byte{}, v...)
+		}
+
+		return nil
+	})
+
+	return value, err
+}
+
+func (s *BoltStore) PutMeta(key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := requiredBucket(tx, metaBucket)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(key), value)
+	})
+}
+
+func (s *BoltStore) GetIndex(index string, key []byte) ([]byte, error) {
+	var value []byte
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(index))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get(key); v != nil {
+			value = append([]byte{}, v...)
+		}
+
+		return nil
+	})
+
+	return value, err
+}
+
+func (s *BoltStore) PutIndex(index string, key, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(index))
+		if err != nil {
+			return err
+		}
+
+		return b.Put(key, value)
+	})
+}
+
+func (s *BoltStore) DeleteIndex(index string, key []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(index))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete(key)
+	})
+}
+
+func (s *BoltStore) ScanIndex(index string, prefix []byte, fn func(key, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(index))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			err := fn(append([]byte{}, k...), append([]byte{}, v...))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *BoltStore) DropIndex(index string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(index))
+		if err == berrors.ErrBucketNotFound {
+			return nil
+		}
+
+		return err
+	})
+}
+
+// NewBoltStore 会创建所有必需的 bucket，这里仍然缺少说明文件被别的程序改动过
+func requiredBucket(tx *bolt.Tx, name string) (*bolt.Bucket, error) {
+	b := tx.Bucket([]byte(name))
+	if b == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMissingBucket, name)
+	}
+
+	return b, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+//------------------------------------------内存实现------------------------------------------
+
+// MemoryStore 就是 002 中原来那条“Block 指针数组”的区块链，额外用一个 map 按哈希找到区块，002 现在直接使用它
+type MemoryStore struct {
+	mu      sync.RWMutex
+	blocks  []*block.Block
+	index   map[string]int //哈希 -> blocks 中的下标
+	tip     []byte
+	pruned  map[string]bool
+	meta    map[string][]byte
+	indexes map[string]map[string][]byte //索引名 -> 键 -> 值
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		index:   make(map[string]int),
+		pruned:  make(map[string]bool),
+		meta:    make(map[string][]byte),
+		indexes: make(map[string]map[string][]byte),
+	}
+}
+
+func (s *MemoryStore) GetBlock(hash []byte) (*block.Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.index[string(hash)]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	block := *s.blocks[i] //返回副本，调用者修改它不会影响存储中的区块
+
+	return &block, nil
+}
+
+func (s *MemoryStore) PutBlock(block *block.Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *block
+	if i, ok := s.index[string(block.Hash)]; ok {
+		s.blocks[i] = &stored
+		return nil
+	}
+	s.index[string(block.Hash)] = len(s.blocks)
+	s.blocks = append(s.blocks, &stored)
+
+	return nil
+}
+
+func (s *MemoryStore) GetTip() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	//返回副本，调用者修改它不能改变 tip；没有 tip 时仍然返回 nil
+	return bytes.Clone(s.tip), nil
+}
+
+func (s *MemoryStore) SetTip(hash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tip = append([]byte{}, hash...)
+
+	return nil
+}
+
+func (s *MemoryStore) CompareAndSwapTip(old, new []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !bytes.Equal(s.tip, old) {
+		return false, nil
+	}
+	s.tip = append([]byte{}, new...)
+
+	return true, nil
+}
+
+func (s *MemoryStore) ForEach(fn func(key []byte, block *block.Block) error) error {
+	s.mu.RLock()
+	blocks := append([]*block.Block{}, s.blocks...)
+	s.mu.RUnlock()
+
+	for _, b := range blocks {
+		block := *b
+		if err := fn(append([]byte{}, b.Hash...), &block); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) PruneBlock(hash []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.index[string(hash)]
+	if !ok {
+		return ErrBlockNotFound
+	}
+	header := *s.blocks[i]
+	header.Data = nil
+	s.blocks[i] = &header
+	s.pruned[string(hash)] = true
+
+	return nil
+}
+
+func (s *MemoryStore) IsPruned(hash []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.pruned[string(hash)], nil
+}
+
+func (s *MemoryStore) GetMeta(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.meta[key], nil
+}
+
+func (s *MemoryStore) PutMeta(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.meta[key] = append([]byte{}, value...)
+
+	return nil
+}
+
+func (s *MemoryStore) GetIndex(index string, key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.indexes[index][string(key)], nil
+}
+
+func (s *MemoryStore) PutIndex(index string, key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.indexes[index] == nil {
+		s.indexes[index] = make(map[string][]byte)
+	}
+	s.indexes[index][string(key)] = append([]byte{}, value...)
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteIndex(index string, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.indexes[index], string(key))
+
+	return nil
+}
+
+func (s *MemoryStore) ScanIndex(index string, prefix []byte, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	var keys []string
+	for k := range s.indexes[index] {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = s.indexes[index][k]
+	}
+	s.mu.RUnlock()
+
+	//回调时不持有锁，fn 里可以再访问存储
+	for i, k := range keys {
+		err := fn([]byte(k), append([]byte{}, values[i]...))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DropIndex(index string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.indexes, index)
+
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
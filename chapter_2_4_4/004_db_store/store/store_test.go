@@ -0,0 +1,234 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"test/blockchain-project/004_db_store/block"
+)
+
+// 在临时目录中打开一个新的 bolt 文件，测试结束时关闭
+func newTestBoltStore(t *testing.T) *BoltStore {
+	t.Helper()
+	s, err := NewBoltStore(filepath.Join(t.TempDir(), "test.db"), DefaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// 需要覆盖每一种存储后端的测试用它来创建存储
+var backends = []struct {
+	name     string
+	newStore func(t *testing.T) BlockStore
+}{
+	{"memory", func(t *testing.T) BlockStore { return NewMemoryStore() }},
+	{"bolt", func(t *testing.T) BlockStore { return newTestBoltStore(t) }},
+	{"cached", func(t *testing.T) BlockStore { return NewCachedStore(NewMemoryStore(), 4) }},
+}
+
+// 期望的旧 tip 已经过时时，比较并交换必须失败，并且不能改动 tip
+func TestCompareAndSwapTip(t *testing.T) {
+	a, b, c := []byte("tip-a"), []byte("tip-b"), []byte("tip-c")
+	steps := []struct {
+		old, new []byte
+		swapped  bool
+		tip      []byte //这一步之后的 tip
+	}{
+		{nil, a, true, a},  //空链
+		{nil, b, false, a}, //以为还是空链
+		{a, b, true, b},
+		{a, c, false, b}, //a 已经被 b 替换了
+		{c, a, false, b}, //从来不是 tip
+		{b, b, true, b},  //换成自己
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			s := backend.newStore(t)
+			for i, step := range steps {
+				swapped, err := s.CompareAndSwapTip(step.old, step.new)
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if swapped != step.swapped {
+					t.Errorf("step %d: CompareAndSwapTip(%q, %q) = %v, want %v", i, step.old, step.new, swapped, step.swapped)
+				}
+				tip, err := s.GetTip()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(tip, step.tip) {
+					t.Errorf("step %d: tip = %q, want %q", i, tip, step.tip)
+				}
+			}
+		})
+	}
+}
+
+// n 个首尾相连的块，第一个是创世块。存储不检查工作量证明，哈希随便取
+func testChain(n int) []*block.Block {
+	var blocks []*block.Block
+	prev := []byte{}
+	for i := 0; i < n; i++ {
+		hash := bytes.Repeat([]byte{byte(i + 1)}, 32)
+		blocks = append(blocks, &block.Block{Timestamp: int64(1700000000 + i), Data: []byte(fmt.Sprintf("block %d", i)), PrevBlockHash: prev, Hash: hash})
+		prev = hash
+	}
+
+	return blocks
+}
+
+// 两种后端对同样的读写必须给出同样的结果
+func TestStoreRoundTrip(t *testing.T) {
+	blocks := testChain(3)
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			s := backend.newStore(t)
+
+			tip, err := s.GetTip()
+			if err != nil || tip != nil {
+				t.Fatalf("empty store: GetTip() = %x, %v, want nil, nil", tip, err)
+			}
+			if _, err := s.GetBlock(blocks[0].Hash); err != ErrBlockNotFound {
+				t.Fatalf("empty store: GetBlock err = %v, want ErrBlockNotFound", err)
+			}
+
+			for _, b := range blocks {
+				if err := s.PutBlock(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.SetTip(blocks[2].Hash); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range blocks {
+				got, err := s.GetBlock(want.Hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Timestamp != want.Timestamp || !bytes.Equal(got.Data, want.Data) || !bytes.Equal(got.PrevBlockHash, want.PrevBlockHash) {
+					t.Errorf("GetBlock(%x) = %+v, want %+v", want.Hash, got, want)
+				}
+			}
+			tip, err = s.GetTip()
+			if err != nil || !bytes.Equal(tip, blocks[2].Hash) {
+				t.Errorf("GetTip() = %x, %v, want %x", tip, err, blocks[2].Hash)
+			}
+
+			//tip 键不能被当成区块遍历出来
+			seen := make(map[string]bool)
+			err = s.ForEach(func(key []byte, b *block.Block) error {
+				if !bytes.Equal(key, b.Hash) {
+					t.Errorf("ForEach key %x, block hash %x", key, b.Hash)
+				}
+				seen[string(b.Hash)] = true
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(seen) != len(blocks) {
+				t.Errorf("ForEach visited %d blocks, want %d", len(seen), len(blocks))
+			}
+		})
+	}
+}
+
+// 修改 MemoryStore 返回的区块和 tip 不能影响存储中的数据
+func TestMemoryStoreCopies(t *testing.T) {
+	s := NewMemoryStore()
+	b := testChain(1)[0]
+	if err := s.PutBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	b.Timestamp = 0
+
+	got, err := s.GetBlock(b.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Timestamp == 0 {
+		t.Error("PutBlock kept a reference to the caller's block")
+	}
+	got.Timestamp = 0
+	again, _ := s.GetBlock(b.Hash)
+	if again.Timestamp == 0 {
+		t.Error("GetBlock returned the stored block instead of a copy")
+	}
+
+	if err := s.SetTip(b.Hash); err != nil {
+		t.Fatal(err)
+	}
+	tip, _ := s.GetTip()
+	tip[0] ^= 0xff
+	tip, _ = s.GetTip()
+	if !bytes.Equal(tip, b.Hash) {
+		t.Errorf("tip = %x after modifying a returned tip, want %x", tip, b.Hash)
+	}
+}
+
+// 不是 bolt 数据库的文件要报告 ErrCorruptDatabase，而不是 panic
+func TestOpenCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corrupt.db")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), 8192), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewBoltStore(path, DefaultBucket)
+	if !errors.Is(err, ErrCorruptDatabase) {
+		t.Errorf("NewBoltStore(corrupt file) error = %v, want ErrCorruptDatabase", err)
+	}
+}
+
+// ForEach 遇到无法解码的块就停下，ScanBlocks 把它作为 *block.Error 交出来并继续遍历
+func TestScanBlocksSkipsCorrupt(t *testing.T) {
+	s := newTestBoltStore(t)
+	blocks := testChain(3)
+	for _, b := range blocks {
+		if err := s.PutBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bad := blocks[1].Hash
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(DefaultBucket)).Put(bad, []byte("not a gob stream"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ForEach(func(key []byte, b *block.Block) error { return nil }); !errors.Is(err, block.ErrCorrupt) {
+		t.Errorf("ForEach error = %v, want block.ErrCorrupt", err)
+	}
+
+	var decoded, corrupt int
+	err = s.ScanBlocks(func(key []byte, b *block.Block, err error) error {
+		var blockErr *block.Error
+		switch {
+		case err == nil:
+			decoded++
+		case errors.As(err, &blockErr) && errors.Is(err, block.ErrCorrupt) && bytes.Equal(blockErr.Hash, bad):
+			corrupt++
+		default:
+			t.Errorf("ScanBlocks(%x) error = %v", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != 2 || corrupt != 1 {
+		t.Errorf("ScanBlocks saw %d decoded and %d corrupt blocks, want 2 and 1", decoded, corrupt)
+	}
+}